@@ -0,0 +1,128 @@
+package reporting
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// BucketTag is the tag of the bucket counters of a BucketHistogram, set to the upper bound of the bucket
+const BucketTag = "le"
+
+// BucketHistogram counts its values in buckets of fixed boundaries. It is reported as a '<name>.bucket'
+// counter per bucket, tagged with the upper bound of the bucket ('le' tag), counting the values lower
+// than or equal to the bound, including a '+Inf' bucket counting all the values, along with the
+// '<name>.sum' and '<name>.count' of the values.
+// Like a counter, it is reported as delta counters when registered with a name returned by
+// DeltaCounterName, with the AsDelta option or with a name matching a DeltaCounters pattern;
+// its values are then expected to be positive.
+// The go-metrics registries ignore this type, it must be registered through
+// the WavefrontMetricsReporter registration methods.
+type BucketHistogram struct {
+	boundaries []float64
+	counts     []int64 // values per bucket, the last bucket counts the values above the highest boundary
+	sum        uint64  // bits of the float64 sum
+}
+
+// NewBucketHistogram creates a BucketHistogram with the given upper bounds of its buckets
+func NewBucketHistogram(boundaries ...float64) *BucketHistogram {
+	bs := append([]float64{}, boundaries...)
+	sort.Float64s(bs)
+	unique := bs[:0]
+	for i, b := range bs {
+		if math.IsInf(b, 1) || math.IsNaN(b) || (i > 0 && b == bs[i-1]) {
+			continue
+		}
+		unique = append(unique, b)
+	}
+	return &BucketHistogram{boundaries: unique, counts: make([]int64, len(unique)+1)}
+}
+
+// Boundaries returns the upper bounds of the buckets, without the '+Inf' bucket
+func (h *BucketHistogram) Boundaries() []float64 {
+	return append([]float64{}, h.boundaries...)
+}
+
+// BucketCounts returns the number of values of every bucket, not including the values of the lower buckets.
+// The last count is the number of values greater than the highest boundary.
+func (h *BucketHistogram) BucketCounts() []int64 {
+	counts := make([]int64, len(h.counts))
+	for i := range h.counts {
+		counts[i] = atomic.LoadInt64(&h.counts[i])
+	}
+	return counts
+}
+
+// Count returns the number of values recorded
+func (h *BucketHistogram) Count() int64 {
+	var count int64
+	for _, c := range h.BucketCounts() {
+		count += c
+	}
+	return count
+}
+
+// Sum returns the sum of the values recorded
+func (h *BucketHistogram) Sum() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&h.sum))
+}
+
+// Update records a value, NaN and infinite values are ignored as they would spoil the sum
+func (h *BucketHistogram) Update(v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	atomic.AddInt64(&h.counts[sort.SearchFloat64s(h.boundaries, v)], 1)
+	for {
+		old := atomic.LoadUint64(&h.sum)
+		updated := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&h.sum, old, updated) {
+			return
+		}
+	}
+}
+
+// UpdateDuration records a duration in the given unit, like time.Millisecond
+func (h *BucketHistogram) UpdateDuration(d, unit time.Duration) {
+	h.Update(float64(d) / float64(unit))
+}
+
+// UpdateSince records the duration elapsed since the given time, in the given unit
+func (h *BucketHistogram) UpdateSince(ts time.Time, unit time.Duration) {
+	h.UpdateDuration(time.Since(ts), unit)
+}
+
+func (r *reporter) reportBucketHistogram(key, name string, h *BucketHistogram, tags map[string]string) {
+	delta := hasDeltaPrefix(name) || r.asDelta(key, name)
+	name = trimDeltaPrefix(name)
+
+	send := func(metricName string, value float64, tags map[string]string, slot string) {
+		if !delta {
+			r.errors <- r.sender.SendMetric(r.prepareName(metricName), value, 0, r.source, tags)
+			return
+		}
+		deltaName := deltaPrefix + r.prepareName(metricName)
+		slot = deltaName + slot
+		r.sendDeltaAs(key, slot, deltaName, r.cumulativeDelta(key, slot, value), tags)
+	}
+
+	counts := h.BucketCounts()
+	var cumulative int64
+	for i, count := range counts {
+		cumulative += count
+		le := "+Inf"
+		if i < len(h.boundaries) {
+			le = strconv.FormatFloat(h.boundaries[i], 'f', -1, 64)
+		}
+		bucketTags := make(map[string]string, len(tags)+1)
+		for k, v := range tags {
+			bucketTags[k] = v
+		}
+		bucketTags[BucketTag] = le
+		send(name+".bucket", float64(cumulative), bucketTags, "|"+BucketTag+"="+le)
+	}
+	send(name+".count", float64(cumulative), tags, "")
+	send(name+".sum", h.Sum(), tags, "")
+}
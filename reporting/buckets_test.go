@@ -0,0 +1,101 @@
+package reporting
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketHistogram(t *testing.T) {
+	h := NewBucketHistogram(300, 100, 100, 1000)
+	assert.Equal(t, []float64{100, 300, 1000}, h.Boundaries())
+
+	h.Update(50)
+	h.Update(100)
+	h.Update(250)
+	h.UpdateDuration(2*time.Second, time.Millisecond)
+
+	assert.Equal(t, []int64{2, 1, 0, 1}, h.BucketCounts())
+	assert.Equal(t, int64(4), h.Count())
+	assert.Equal(t, 2400.0, h.Sum())
+
+	h.Update(math.NaN())
+	h.Update(math.Inf(1))
+	assert.Equal(t, int64(4), h.Count())
+	assert.Equal(t, 2400.0, h.Sum())
+}
+
+func TestReportBucketHistogram(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(), CustomRegistry(metrics.NewRegistry()), Prefix("app"))
+
+	h := NewBucketHistogram(100, 300)
+	assert.NoError(t, reporter.RegisterMetric("latency", h, map[string]string{"route": "/"}))
+	assert.Equal(t, TypeBucketHistogram, TypeOf(reporter.GetMetric("latency", map[string]string{"route": "/"})))
+	h.Update(50)
+	h.Update(200)
+	h.Update(500)
+	reporter.Report()
+
+	buckets := map[string]float64{}
+	values := map[string]float64{}
+	for _, m := range sender.Metrics {
+		if m.Name == "app.latency.bucket" {
+			assert.Equal(t, "/", m.Tags["route"])
+			buckets[m.Tags[BucketTag]] = m.Value
+		} else {
+			assert.Equal(t, map[string]string{"route": "/"}, m.Tags)
+			values[m.Name] = m.Value
+		}
+	}
+	assert.Equal(t, map[string]float64{"100": 1, "300": 2, "+Inf": 3}, buckets)
+	assert.Equal(t, map[string]float64{"app.latency.count": 3, "app.latency.sum": 750}, values)
+
+	reporter.Close()
+}
+
+func TestReportBucketHistogramDeltas(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(), CustomRegistry(metrics.NewRegistry()))
+
+	h := NewBucketHistogram(1)
+	reporter.RegisterMetric(DeltaCounterName("sizes"), h, nil)
+
+	deltas := func() map[string]float64 {
+		res := map[string]float64{}
+		for _, d := range sender.Deltas {
+			name := d.Name
+			if le, ok := d.Tags[BucketTag]; ok {
+				name += "," + le
+			}
+			res[name] = d.Value
+		}
+		sender.Deltas = sender.Deltas[:0]
+		return res
+	}
+
+	h.Update(1)
+	h.Update(2)
+	reporter.Report()
+	assert.Equal(t, map[string]float64{
+		deltaPrefix + "sizes.bucket,1":    1,
+		deltaPrefix + "sizes.bucket,+Inf": 2,
+		deltaPrefix + "sizes.count":       2,
+		deltaPrefix + "sizes.sum":         3,
+	}, deltas())
+
+	h.Update(5)
+	reporter.Report()
+	assert.Equal(t, map[string]float64{
+		deltaPrefix + "sizes.bucket,1":    0,
+		deltaPrefix + "sizes.bucket,+Inf": 1,
+		deltaPrefix + "sizes.count":       1,
+		deltaPrefix + "sizes.sum":         5,
+	}, deltas())
+	assert.Empty(t, sender.Metrics)
+
+	reporter.Close()
+}
@@ -0,0 +1,212 @@
+package reporting
+
+import (
+	"hash/fnv"
+	"log"
+	"math"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowTagValue replaces every tag value of a series folded into the overflow series
+// of a metric name whose cardinality limit has been reached.
+const OverflowTagValue = "__overflow__"
+
+// OverflowTagKey is the tag of the overflow series of the series without tags,
+// so the overflow series differs from the series without tags.
+const OverflowTagKey = "overflow"
+
+// CardinalityLimit caps the number of distinct tag combinations registered through the
+// reporter for every metric name. Once the limit is reached new combinations are folded
+// into a single overflow series whose tag values are all OverflowTagValue, or tagged with
+// OverflowTagKey if the series has no tags.
+// A limit of 0 (the default) means no limit.
+func CardinalityLimit(limit int) Option {
+	return func(args *reporter) {
+		args.cardinality.limit = limit
+	}
+}
+
+// MetricCardinalityLimit overrides the CardinalityLimit for the given metric name.
+// A limit of 0 means no limit for that name.
+func MetricCardinalityLimit(name string, limit int) Option {
+	return func(args *reporter) {
+		args.cardinality.limits[name] = limit
+	}
+}
+
+// cardinalityLimiter tracks the tag combinations registered per metric name
+type cardinalityLimiter struct {
+	mux    sync.RWMutex
+	limit  int
+	limits map[string]int
+	series map[string]map[string]bool // metric name -> registered keys
+	folded map[string]*hyperLogLog    // metric name -> estimate of the keys folded into the overflow series
+}
+
+func newCardinalityLimiter() *cardinalityLimiter {
+	return &cardinalityLimiter{
+		limits: make(map[string]int),
+		series: make(map[string]map[string]bool),
+		folded: make(map[string]*hyperLogLog),
+	}
+}
+
+func (c *cardinalityLimiter) limitFor(name string) int {
+	if limit, ok := c.limits[name]; ok {
+		return limit
+	}
+	return c.limit
+}
+
+// admit records a registration and returns the tags it must be registered with, which are
+// the overflow tags, and true, if the metric name is over its limit.
+// The known series and the series folded once the limit is reached only take the read lock.
+func (c *cardinalityLimiter) admit(name string, tags map[string]string) (map[string]string, bool) {
+	limit := c.limitFor(name)
+	if limit <= 0 {
+		return tags, false
+	}
+	key := EncodeKey(name, tags)
+	hash := keyHash(key)
+
+	c.mux.RLock()
+	keys := c.series[name]
+	known, full, folded := keys[key], len(keys) >= limit, c.folded[name]
+	c.mux.RUnlock()
+	if known {
+		return tags, false
+	}
+	if full && folded != nil {
+		folded.add(hash)
+		return overflowTags(tags), true
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	keys = c.series[name]
+	if keys[key] {
+		return tags, false
+	}
+	if len(keys) < limit {
+		if keys == nil {
+			keys = make(map[string]bool)
+			c.series[name] = keys
+		}
+		keys[key] = true
+		return tags, false
+	}
+	if _, ok := c.folded[name]; !ok {
+		log.Printf("cardinality limit of %d series reached for metric '%s', new series are reported with tag values '%s'",
+			limit, name, OverflowTagValue)
+		c.folded[name] = &hyperLogLog{}
+	}
+	c.folded[name].add(hash)
+	return overflowTags(tags), true
+}
+
+// resolve returns the tags under which a lookup of the given series must be done
+func (c *cardinalityLimiter) resolve(name string, tags map[string]string) map[string]string {
+	limit := c.limitFor(name)
+	if limit <= 0 {
+		return tags
+	}
+
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	keys := c.series[name]
+	if !keys[EncodeKey(name, tags)] && len(keys) >= limit {
+		return overflowTags(tags)
+	}
+	return tags
+}
+
+// keyHash returns the hash under which a folded series is counted
+func keyHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	// mix the bits, as the registers of the estimates are chosen by the highest bits
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+const hllBits = 10
+
+// hyperLogLog estimates the number of distinct hashes added, within about 3%, in a fixed memory
+// (see "HyperLogLog: the analysis of a near-optimal cardinality estimation algorithm", Flajolet et al.)
+type hyperLogLog struct {
+	registers [1 << hllBits]uint32
+}
+
+func (h *hyperLogLog) add(hash uint64) {
+	idx := hash >> (64 - hllBits)
+	rank := uint32(bits.LeadingZeros64(hash<<hllBits|1<<(hllBits-1))) + 1
+	for {
+		old := atomic.LoadUint32(&h.registers[idx])
+		if rank <= old || atomic.CompareAndSwapUint32(&h.registers[idx], old, rank) {
+			return
+		}
+	}
+}
+
+func (h *hyperLogLog) estimate() int64 {
+	m := float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for i := range h.registers {
+		r := atomic.LoadUint32(&h.registers[i])
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		// linear counting is more accurate for the small cardinalities
+		e = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(e))
+}
+
+// forget removes the given series so its slot can be used by a new tag combination
+func (c *cardinalityLimiter) forget(name string, tags map[string]string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if keys, ok := c.series[name]; ok {
+		delete(keys, EncodeKey(name, tags))
+		if len(keys) == 0 {
+			delete(c.series, name)
+		}
+	}
+}
+
+// overflows returns the estimated number of distinct tag combinations folded into the overflow series per metric name
+func (c *cardinalityLimiter) overflows() map[string]int64 {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	res := make(map[string]int64, len(c.folded))
+	for name, folded := range c.folded {
+		res[name] = folded.estimate()
+	}
+	return res
+}
+
+func overflowTags(tags map[string]string) map[string]string {
+	if len(tags) == 0 {
+		return map[string]string{OverflowTagKey: OverflowTagValue}
+	}
+	res := make(map[string]string, len(tags))
+	for k := range tags {
+		res[k] = OverflowTagValue
+	}
+	return res
+}
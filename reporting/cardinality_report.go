@@ -0,0 +1,139 @@
+package reporting
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// CardinalityReport describes the series of a registry grouped by metric name
+type CardinalityReport struct {
+	Series  int                 // total number of series
+	Metrics []MetricCardinality // sorted by descending number of series
+}
+
+// MetricCardinality describes the series registered under a metric name
+type MetricCardinality struct {
+	Name   string
+	Series int
+	Tags   []TagCardinality // sorted by descending number of distinct values
+}
+
+// TagCardinality describes the values of a tag key for a metric name
+type TagCardinality struct {
+	Key    string
+	Values int             // number of distinct values
+	Top    []TagValueCount // values used by the most series, sorted by descending number of series
+}
+
+// TagValueCount is the number of series using a tag value
+type TagValueCount struct {
+	Value  string
+	Series int
+}
+
+// CardinalityMetrics enables reporting the number of series per metric name and the
+// number of distinct values per tag key as reporter self-metrics.
+func CardinalityMetrics(enable bool) Option {
+	return func(args *reporter) {
+		args.cardinalityMetrics = enable
+	}
+}
+
+// AnalyzeCardinality groups the series of the registry by metric name,
+// keeping the top most used values of every tag key (all of them if top is negative).
+func AnalyzeCardinality(registry metrics.Registry, top int) CardinalityReport {
+	values := make(map[string]map[string]map[string]int) // name -> tag key -> tag value -> series
+	series := make(map[string]int)
+	report := CardinalityReport{}
+
+	registry.Each(func(key string, metric interface{}) {
+		name, tags := DecodeKey(key)
+		report.Series++
+		series[name]++
+		if _, ok := values[name]; !ok {
+			values[name] = make(map[string]map[string]int)
+		}
+		for k, v := range tags {
+			if _, ok := values[name][k]; !ok {
+				values[name][k] = make(map[string]int)
+			}
+			values[name][k][v]++
+		}
+	})
+
+	for name, count := range series {
+		mc := MetricCardinality{Name: name, Series: count}
+		for k, vs := range values[name] {
+			tc := TagCardinality{Key: k, Values: len(vs)}
+			for v, c := range vs {
+				tc.Top = append(tc.Top, TagValueCount{Value: v, Series: c})
+			}
+			sort.Slice(tc.Top, func(i, j int) bool {
+				if tc.Top[i].Series != tc.Top[j].Series {
+					return tc.Top[i].Series > tc.Top[j].Series
+				}
+				return tc.Top[i].Value < tc.Top[j].Value
+			})
+			if top >= 0 && len(tc.Top) > top {
+				tc.Top = tc.Top[:top]
+			}
+			mc.Tags = append(mc.Tags, tc)
+		}
+		sort.Slice(mc.Tags, func(i, j int) bool {
+			if mc.Tags[i].Values != mc.Tags[j].Values {
+				return mc.Tags[i].Values > mc.Tags[j].Values
+			}
+			return mc.Tags[i].Key < mc.Tags[j].Key
+		})
+		report.Metrics = append(report.Metrics, mc)
+	}
+	sort.Slice(report.Metrics, func(i, j int) bool {
+		if report.Metrics[i].Series != report.Metrics[j].Series {
+			return report.Metrics[i].Series > report.Metrics[j].Series
+		}
+		return report.Metrics[i].Name < report.Metrics[j].Name
+	})
+	return report
+}
+
+// WriteTo writes a human readable dump of the report
+func (c CardinalityReport) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d series in %d metrics\n", c.Series, len(c.Metrics))
+	for _, m := range c.Metrics {
+		fmt.Fprintf(&buf, "%s: %d series\n", m.Name, m.Series)
+		for _, t := range m.Tags {
+			fmt.Fprintf(&buf, "  %s: %d values\n", t.Key, t.Values)
+			for _, v := range t.Top {
+				fmt.Fprintf(&buf, "    %s: %d series\n", v.Value, v.Series)
+			}
+		}
+	}
+	return buf.WriteTo(w)
+}
+
+func (c CardinalityReport) String() string {
+	var buf bytes.Buffer
+	c.WriteTo(&buf)
+	return buf.String()
+}
+
+// AnalyzeCardinality groups the series of the reporter registry by metric name
+func (r *reporter) AnalyzeCardinality(top int) CardinalityReport {
+	return AnalyzeCardinality(r.registry, top)
+}
+
+func (r *reporter) reportCardinality() {
+	for _, m := range AnalyzeCardinality(r.registry, 0).Metrics {
+		tags := r.addApplicationTags(map[string]string{"metric": m.Name})
+		r.errors <- r.sender.SendMetric(internalPrefix+"cardinality.series", float64(m.Series), 0, r.source, tags)
+		for _, t := range m.Tags {
+			tags := r.addApplicationTags(map[string]string{"metric": m.Name, "tag": t.Key})
+			r.errors <- r.sender.SendMetric(internalPrefix+"cardinality.tag-values", float64(t.Values), 0, r.source, tags)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package reporting
+
+import (
+	"strconv"
+	"testing"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/wavefronthq/wavefront-sdk-go/application"
+)
+
+func TestCardinalityLimit(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewReporter(sender, application.New("app", "srv"), DisableAutoStart(),
+		LogErrors(true), CustomRegistry(metrics.NewRegistry()), CardinalityLimit(3))
+
+	for i := 0; i < 10; i++ {
+		tags := map[string]string{"user": strconv.Itoa(i)}
+		c := reporter.GetOrRegisterMetric("requests", metrics.NewCounter(), tags).(metrics.Counter)
+		c.Inc(1)
+	}
+
+	overflow := reporter.GetMetric("requests", map[string]string{"user": "42"})
+	assert.NotNil(t, overflow)
+	assert.Equal(t, int64(7), overflow.(metrics.Counter).Count())
+	assert.Equal(t, overflow, reporter.GetMetric("requests", map[string]string{"user": OverflowTagValue}))
+	assert.Equal(t, int64(1), reporter.GetMetric("requests", map[string]string{"user": "0"}).(metrics.Counter).Count())
+
+	reporter.Report()
+
+	series := map[string]bool{}
+	for _, metric := range sender.Metrics {
+		switch metric.Name {
+		case "requests.count":
+			series[metric.Tags["user"]] = true
+		case internalPrefix + "cardinality.overflow.count":
+			assert.Equal(t, "requests", metric.Tags["metric"])
+		default:
+			t.Errorf("unexpected metric: '%v'", metric)
+		}
+	}
+	assert.Equal(t, map[string]bool{"0": true, "1": true, "2": true, OverflowTagValue: true}, series)
+
+	reporter.Close()
+}
+
+func TestCardinalityLimitUnregister(t *testing.T) {
+	reporter := NewMetricsReporter(newMockSender(), DisableAutoStart(),
+		CustomRegistry(metrics.NewRegistry()), CardinalityLimit(1), MetricCardinalityLimit("unlimited", 0))
+
+	c1, c2 := metrics.NewCounter(), metrics.NewCounter()
+	assert.NoError(t, reporter.RegisterMetric("m", c1, map[string]string{"k": "1"}))
+	assert.NoError(t, reporter.RegisterMetric("m", c2, map[string]string{"k": "2"}))
+	assert.Equal(t, c2, reporter.GetMetric("m", map[string]string{"k": OverflowTagValue}))
+
+	reporter.UnregisterMetric("m", map[string]string{"k": "1"})
+	c3 := metrics.NewCounter()
+	assert.NoError(t, reporter.RegisterMetric("m", c3, map[string]string{"k": "3"}))
+	assert.Equal(t, c3, reporter.GetMetric("m", map[string]string{"k": "3"}))
+
+	for i := 0; i < 5; i++ {
+		tags := map[string]string{"k": strconv.Itoa(i)}
+		assert.NoError(t, reporter.RegisterMetric("unlimited", metrics.NewCounter(), tags))
+		assert.NotNil(t, reporter.GetMetric("unlimited", tags))
+	}
+
+	reporter.Close()
+}
+
+func TestCardinalityOverflowCount(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(), CustomRegistry(metrics.NewRegistry()), CardinalityLimit(1))
+
+	c1, c2, c3 := metrics.NewCounter(), metrics.NewCounter(), metrics.NewCounter()
+	assert.NoError(t, reporter.RegisterMetric("m", c1, map[string]string{"k": "1"}))
+	assert.NoError(t, reporter.RegisterMetric("m", c2, map[string]string{"k": "2"}))
+	// a later series over the limit cannot be registered as the overflow series already exists
+	assert.Error(t, reporter.RegisterMetric("m", c3, map[string]string{"k": "3"}))
+	assert.Equal(t, c2, reporter.GetMetric("m", map[string]string{"k": "3"}))
+
+	// the lookups of a folded series do not count it again
+	for i := 0; i < 5; i++ {
+		reporter.GetOrRegisterMetric("m", metrics.NewCounter, map[string]string{"k": "2"})
+	}
+	reporter.Report()
+	overflows := map[string]float64{}
+	for _, metric := range sender.Metrics {
+		if metric.Name == internalPrefix+"cardinality.overflow.count" {
+			overflows[metric.Tags["metric"]] = metric.Value
+		}
+	}
+	assert.Equal(t, map[string]float64{"m": 2}, overflows)
+
+	reporter.Close()
+}
+
+func TestCardinalityOverflowUntagged(t *testing.T) {
+	registry := metrics.NewRegistry()
+	reporter := NewMetricsReporter(newMockSender(), DisableAutoStart(), CustomRegistry(registry), CardinalityLimit(1))
+
+	assert.NoError(t, reporter.RegisterMetric("m", metrics.NewCounter(), map[string]string{"k": "1"}))
+	c := metrics.NewCounter()
+	assert.NoError(t, reporter.RegisterMetric("m", c, nil))
+	// the overflow series of the untagged series is not the untagged series
+	assert.Nil(t, registry.Get(EncodeKey("m", nil)))
+	assert.Equal(t, c, registry.Get(EncodeKey("m", map[string]string{OverflowTagKey: OverflowTagValue})))
+	assert.Equal(t, c, reporter.GetMetric("m", nil))
+
+	reporter.Close()
+}
+
+func TestCardinalityOverflowEstimate(t *testing.T) {
+	c := newCardinalityLimiter()
+	c.limit = 1
+	for i := 0; i < 20000; i++ {
+		c.admit("m", map[string]string{"k": strconv.Itoa(i)})
+	}
+	// the folded series are estimated in a fixed memory
+	assert.InEpsilon(t, 19999, c.overflows()["m"], 0.1)
+	assert.Equal(t, 1, len(c.folded))
+}
+
+func TestCardinalityLimitSweep(t *testing.T) {
+	registry := metrics.NewRegistry()
+	reporter := NewMetricsReporter(newMockSender(), DisableAutoStart(), CustomRegistry(registry), CardinalityLimit(1))
+
+	tags := map[string]string{"k": "1"}
+	assert.NoError(t, reporter.RegisterMetric("m", metrics.NewCounter(), tags))
+	reporter.Report()
+
+	// unregistered without going through the reporter, its slot is freed by the next report
+	registry.Unregister(EncodeKey("m", tags))
+	reporter.Report()
+	c := metrics.NewCounter()
+	assert.NoError(t, reporter.RegisterMetric("m", c, map[string]string{"k": "2"}))
+	assert.Equal(t, c, reporter.GetMetric("m", map[string]string{"k": "2"}))
+
+	reporter.Close()
+}
+
+func TestAnalyzeCardinality(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(),
+		CustomRegistry(metrics.NewRegistry()), CardinalityMetrics(true)).(ExtendedMetricsReporter)
+
+	for i := 0; i < 6; i++ {
+		tags := map[string]string{"user": strconv.Itoa(i), "region": strconv.Itoa(i % 2)}
+		reporter.RegisterMetric("requests", metrics.NewCounter(), tags)
+	}
+	reporter.RegisterMetric("errors", metrics.NewCounter(), map[string]string{"region": "0"})
+	reporter.RegisterMetric("uptime", metrics.NewGauge(), nil)
+
+	report := reporter.AnalyzeCardinality(1)
+	assert.Equal(t, 8, report.Series)
+	assert.Equal(t, 3, len(report.Metrics))
+
+	requests := report.Metrics[0]
+	assert.Equal(t, "requests", requests.Name)
+	assert.Equal(t, 6, requests.Series)
+	assert.Equal(t, []TagCardinality{
+		{Key: "user", Values: 6, Top: []TagValueCount{{Value: "0", Series: 1}}},
+		{Key: "region", Values: 2, Top: []TagValueCount{{Value: "0", Series: 3}}},
+	}, requests.Tags)
+	assert.Equal(t, "errors", report.Metrics[1].Name)
+	assert.Equal(t, "uptime", report.Metrics[2].Name)
+	assert.Empty(t, report.Metrics[2].Tags)
+
+	dump := report.String()
+	assert.Contains(t, dump, "8 series in 3 metrics\n")
+	assert.Contains(t, dump, "requests: 6 series\n  user: 6 values\n    0: 1 series\n")
+
+	reporter.Report()
+
+	tagValues := map[string]string{}
+	for _, metric := range sender.Metrics {
+		if metric.Name == internalPrefix+"cardinality.tag-values" && metric.Tags["metric"] == "requests" {
+			tagValues[metric.Tags["tag"]] = metric.Tags["metric"]
+		}
+	}
+	assert.Equal(t, map[string]string{"user": "requests", "region": "requests"}, tagValues)
+
+	reporter.Close()
+}
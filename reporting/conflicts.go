@@ -0,0 +1,96 @@
+package reporting
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// TypeConflictPolicy decides what happens when a series is registered with a metric type
+// different from the type of the series already registered under the same metric name.
+type TypeConflictPolicy int
+
+const (
+	// IgnoreTypeConflicts registers the series without checking its type
+	IgnoreTypeConflicts TypeConflictPolicy = iota
+	// WarnTypeConflicts registers the series and logs a warning
+	WarnTypeConflicts
+	// RejectTypeConflicts does not register the series
+	RejectTypeConflicts
+)
+
+// TypeConflicts sets how the reporter registration APIs handle series registered with
+// a metric type different from the other series of the same metric name.
+// Defaults to IgnoreTypeConflicts.
+func TypeConflicts(policy TypeConflictPolicy) Option {
+	return func(args *reporter) {
+		args.types.policy = policy
+	}
+}
+
+// typeTracker tracks the metric type of the series registered per metric name
+type typeTracker struct {
+	mux    sync.Mutex
+	policy TypeConflictPolicy
+	names  map[string]*nameType
+}
+
+type nameType struct {
+	typ  MetricType
+	keys map[string]bool
+}
+
+func newTypeTracker() *typeTracker {
+	return &typeTracker{names: make(map[string]*nameType)}
+}
+
+func (t *typeTracker) enabled() bool {
+	return t.policy != IgnoreTypeConflicts
+}
+
+// admit records the type of a new series,
+// returns a RegistryError if the series type conflicts and conflicts are rejected.
+func (t *typeTracker) admit(name, key string, metric interface{}) error {
+	if !t.enabled() {
+		return nil
+	}
+
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	typ := TypeOf(metric)
+	nt, ok := t.names[name]
+	if !ok {
+		nt = &nameType{typ: typ, keys: make(map[string]bool)}
+		t.names[name] = nt
+	}
+	if nt.keys[key] {
+		return nil
+	}
+	if nt.typ != typ {
+		msg := fmt.Sprintf("Metric '%s' registered as %s, already registered as %s.", name, typ, nt.typ)
+		if t.policy == RejectTypeConflicts {
+			return RegistryError(msg)
+		}
+		log.Printf("type conflict: %s", msg)
+	}
+	nt.keys[key] = true
+	return nil
+}
+
+// forget removes the series with the given key, the metric name type is forgotten with its last series
+func (t *typeTracker) forget(name, key string) {
+	if !t.enabled() {
+		return
+	}
+
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if nt, ok := t.names[name]; ok {
+		delete(nt.keys, key)
+		if len(nt.keys) == 0 {
+			delete(t.names, name)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package reporting
+
+import (
+	"testing"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRejectTypeConflicts(t *testing.T) {
+	reporter := NewMetricsReporter(newMockSender(), DisableAutoStart(),
+		CustomRegistry(metrics.NewRegistry()), TypeConflicts(RejectTypeConflicts))
+
+	shard1 := map[string]string{"shard": "1"}
+	shard2 := map[string]string{"shard": "2"}
+	assert.NoError(t, reporter.RegisterMetric("db.latency", metrics.NewTimer(), shard1))
+
+	err := reporter.RegisterMetric("db.latency", metrics.NewHistogram(metrics.NewUniformSample(10)), shard2)
+	assert.IsType(t, RegistryError(""), err)
+	assert.Nil(t, reporter.GetMetric("db.latency", shard2))
+
+	assert.Nil(t, reporter.GetOrRegisterMetric("db.latency", metrics.NewCounter, shard2))
+	assert.Nil(t, reporter.GetMetric("db.latency", shard2))
+	assert.NotNil(t, reporter.GetOrRegisterMetric("db.latency", metrics.NewTimer, shard2))
+	assert.NotNil(t, reporter.GetOrRegisterMetric("db.latency", metrics.NewCounter, shard1))
+
+	reporter.UnregisterMetric("db.latency", shard1)
+	reporter.UnregisterMetric("db.latency", shard2)
+	assert.NoError(t, reporter.RegisterMetric("db.latency", metrics.NewCounter(), shard1))
+
+	reporter.Close()
+}
+
+func TestWarnTypeConflicts(t *testing.T) {
+	reporter := NewMetricsReporter(newMockSender(), DisableAutoStart(),
+		CustomRegistry(metrics.NewRegistry()), TypeConflicts(WarnTypeConflicts))
+
+	assert.NoError(t, reporter.RegisterMetric("db.latency", metrics.NewTimer(), map[string]string{"shard": "1"}))
+	assert.NoError(t, reporter.RegisterMetric("db.latency", metrics.NewCounter(), map[string]string{"shard": "2"}))
+
+	reporter.Close()
+}
@@ -0,0 +1,85 @@
+package reporting
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// CounterFloat64 holds a float64 value that can be incremented and decremented.
+// It is reported like a metrics.Counter, including as a delta counter when
+// registered with a name returned by DeltaCounterName.
+// The go-metrics registries ignore this type, it must be registered through
+// the WavefrontMetricsReporter registration methods.
+type CounterFloat64 interface {
+	Clear()
+	Count() float64
+	Dec(float64)
+	Inc(float64)
+	Snapshot() CounterFloat64
+}
+
+// NewCounterFloat64 constructs a new StandardCounterFloat64.
+func NewCounterFloat64() CounterFloat64 {
+	return &StandardCounterFloat64{}
+}
+
+// CounterFloat64Snapshot is a read-only copy of another CounterFloat64.
+type CounterFloat64Snapshot float64
+
+// Clear panics.
+func (CounterFloat64Snapshot) Clear() {
+	panic("Clear called on a CounterFloat64Snapshot")
+}
+
+// Count returns the count at the time the snapshot was taken.
+func (c CounterFloat64Snapshot) Count() float64 { return float64(c) }
+
+// Dec panics.
+func (CounterFloat64Snapshot) Dec(float64) {
+	panic("Dec called on a CounterFloat64Snapshot")
+}
+
+// Inc panics.
+func (CounterFloat64Snapshot) Inc(float64) {
+	panic("Inc called on a CounterFloat64Snapshot")
+}
+
+// Snapshot returns the snapshot.
+func (c CounterFloat64Snapshot) Snapshot() CounterFloat64 { return c }
+
+// StandardCounterFloat64 is the standard implementation of a CounterFloat64,
+// it stores the bits of the float64 value and updates them atomically.
+type StandardCounterFloat64 struct {
+	bits uint64
+}
+
+// Clear sets the counter to zero.
+func (c *StandardCounterFloat64) Clear() {
+	atomic.StoreUint64(&c.bits, math.Float64bits(0))
+}
+
+// Count returns the current count.
+func (c *StandardCounterFloat64) Count() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&c.bits))
+}
+
+// Dec decrements the counter by the given amount.
+func (c *StandardCounterFloat64) Dec(v float64) {
+	c.Inc(-v)
+}
+
+// Inc increments the counter by the given amount.
+func (c *StandardCounterFloat64) Inc(v float64) {
+	for {
+		old := atomic.LoadUint64(&c.bits)
+		updated := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&c.bits, old, updated) {
+			return
+		}
+	}
+}
+
+// Snapshot returns a read-only copy of the counter.
+func (c *StandardCounterFloat64) Snapshot() CounterFloat64 {
+	return CounterFloat64Snapshot(c.Count())
+}
@@ -0,0 +1,66 @@
+package reporting
+
+import (
+	"sync"
+	"testing"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterFloat64(t *testing.T) {
+	c := NewCounterFloat64()
+	c.Inc(1.5)
+	c.Dec(0.25)
+	assert.Equal(t, 1.25, c.Count())
+
+	snapshot := c.Snapshot()
+	c.Inc(1)
+	assert.Equal(t, 1.25, snapshot.Count())
+	assert.Panics(t, func() { snapshot.Inc(1) })
+
+	c.Clear()
+	assert.Equal(t, float64(0), c.Count())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.Inc(0.5)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, float64(5000), c.Count())
+}
+
+func TestReportCounterFloat64(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(), CustomRegistry(metrics.NewRegistry()))
+
+	plain := NewCounterFloat64()
+	delta := NewCounterFloat64()
+	reporter.RegisterMetric("cost", plain, nil)
+	reporter.RegisterMetric(DeltaCounterName("megabytes"), delta, nil)
+
+	plain.Inc(0.5)
+	delta.Inc(2.5)
+	reporter.Report()
+
+	assert.Equal(t, []MockMetirc{{Name: "cost.count", Tags: map[string]string{}, Value: 0.5}}, sender.Metrics)
+	assert.Equal(t, []MockMetirc{{Name: deltaPrefix + "megabytes.count", Tags: map[string]string{}, Value: 2.5}}, sender.Deltas)
+	assert.Equal(t, float64(0), delta.Count())
+	assert.Equal(t, TypeCounterFloat64, TypeOf(plain))
+	assert.Equal(t, plain, reporter.GetOrRegisterMetric("cost", NewCounterFloat64, nil))
+	assert.Error(t, reporter.RegisterMetric("cost", NewCounterFloat64(), nil))
+
+	reporter.UnregisterMetric("cost", nil)
+	assert.Nil(t, reporter.GetMetric("cost", nil))
+	lazy := reporter.GetOrRegisterMetric("cost", NewCounterFloat64, nil)
+	assert.NotNil(t, lazy)
+	assert.Equal(t, lazy, reporter.GetMetric("cost", nil))
+
+	reporter.Close()
+}
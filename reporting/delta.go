@@ -1,6 +1,7 @@
 package reporting
 
 import (
+	"math"
 	"strings"
 	"unicode/utf8"
 )
@@ -24,3 +25,151 @@ func DeltaCounterName(name string) string {
 func hasDeltaPrefix(name string) bool {
 	return strings.HasPrefix(name, deltaPrefix) || strings.HasPrefix(name, altDeltaPrefix)
 }
+
+// trimDeltaPrefix returns the name without its delta prefix
+func trimDeltaPrefix(name string) string {
+	if strings.HasPrefix(name, deltaPrefix) {
+		return name[deltaPrefixSize:]
+	} else if strings.HasPrefix(name, altDeltaPrefix) {
+		return name[altDeltaPrefixSize:]
+	}
+	return name
+}
+
+// deltaName returns the reported name of a counter reported as a delta counter
+func (r *reporter) deltaName(name string) string {
+	return deltaPrefix + r.prepareName(trimDeltaPrefix(name), "count")
+}
+
+// DeltaCarryLimit bounds the delta counter amount that failed to be sent and is carried
+// forward to the next reporting cycles. The amount over the limit is dropped and
+// reported by the '~go-metrics-wavefront.delta.dropped.count' metric.
+// A limit of 0 (the default) carries forward any amount.
+func DeltaCarryLimit(limit float64) Option {
+	return func(args *reporter) {
+		args.deltaCarryLimit = limit
+	}
+}
+
+// sendDelta sends a delta counter increment along with the increments that failed to be sent
+// during the previous reporting cycles, which are kept until the sender accepts them.
+func (r *reporter) sendDelta(key, name string, value float64, tags map[string]string) {
+	r.sendDeltaAs(key, name, name, value, tags)
+}
+
+// sendDeltaAs is sendDelta for the series sending several delta counters with the same name,
+// the amounts not sent yet are kept under the given slot.
+func (r *reporter) sendDeltaAs(key, slot, name string, value float64, tags map[string]string) {
+	r.seriesMux.Lock()
+	st := r.state(key)
+	value += st.pending[slot]
+	r.seriesMux.Unlock()
+
+	err := r.sender.SendDeltaCounter(name, value, r.source, tags)
+	r.errors <- err
+
+	r.seriesMux.Lock()
+	defer r.seriesMux.Unlock()
+
+	if err == nil {
+		delete(st.pending, slot)
+		return
+	}
+	if r.deltaCarryLimit > 0 && math.Abs(value) > r.deltaCarryLimit {
+		carried := math.Copysign(r.deltaCarryLimit, value)
+		r.deltaDropped += math.Abs(value - carried)
+		value = carried
+	}
+	if st.pending == nil {
+		st.pending = make(map[string]float64)
+	}
+	st.pending[slot] = value
+}
+
+// DeltaCounters reports the plain counters, and the bucket histograms, whose name matches one of the
+// given patterns (see path.Match) as delta counters, sending the difference with the count of the
+// previous reporting cycle. Unlike DeltaCounterName, the counters are not modified by the reporter.
+func DeltaCounters(patterns ...string) Option {
+	return func(args *reporter) {
+		args.deltaPatterns = append(args.deltaPatterns, patterns...)
+	}
+}
+
+// RegisterOption customizes how a registered series is reported
+type RegisterOption func(*seriesState)
+
+// AsDelta reports the registered counter, or bucket histogram, as delta counters, like the DeltaCounters option
+func AsDelta() RegisterOption {
+	return func(st *seriesState) {
+		st.asDelta = true
+	}
+}
+
+// asDelta reports whether the plain counter or bucket histogram with the given key and name must be reported as delta counters
+func (r *reporter) asDelta(key, name string) bool {
+	for _, pattern := range r.deltaPatterns {
+		if matchName(pattern, name) {
+			return true
+		}
+	}
+
+	r.seriesMux.Lock()
+	defer r.seriesMux.Unlock()
+
+	return r.state(key).asDelta
+}
+
+// cumulativeDelta returns the difference between a cumulative value and its value during the previous
+// reporting cycle. A value lower than the previous one is the first value after a reset.
+func (r *reporter) cumulativeDelta(key, name string, value float64) float64 {
+	r.seriesMux.Lock()
+	defer r.seriesMux.Unlock()
+
+	st := r.state(key)
+	if st.last == nil {
+		st.last = make(map[string]float64)
+	}
+	last := st.last[name]
+	st.last[name] = value
+	if value < last {
+		return value
+	}
+	return value - last
+}
+
+// reportCounterDelta reports the count of a plain counter as a delta counter
+func (r *reporter) reportCounterDelta(key, name string, count float64, tags map[string]string) {
+	deltaName := r.deltaName(name)
+	r.sendDelta(key, deltaName, r.cumulativeDelta(key, deltaName, count), tags)
+}
+
+// CountMode selects how the counts of meters, timers and histograms are reported
+type CountMode int
+
+const (
+	// CountsAsGauges reports the total count as a '<name>.count' gauge
+	CountsAsGauges CountMode = iota
+	// CountsAsDeltas reports the count since the previous reporting cycle as a '∆<name>.count' delta counter
+	CountsAsDeltas
+	// CountsAsGaugesAndDeltas reports both the total count gauge and the delta counter
+	CountsAsGaugesAndDeltas
+)
+
+// EmbeddedCounts sets how the counts of meters, timers and histograms are reported.
+// Defaults to CountsAsGauges.
+func EmbeddedCounts(mode CountMode) Option {
+	return func(args *reporter) {
+		args.countMode = mode
+	}
+}
+
+// reportCount reports the count of a meter, timer or histogram
+func (r *reporter) reportCount(key, name string, count int64, tags map[string]string) {
+	if r.countMode != CountsAsDeltas {
+		r.errors <- r.sender.SendMetric(r.prepareName(name+".count"), float64(count), 0, r.source, tags)
+	}
+	if r.countMode != CountsAsGauges {
+		deltaName := deltaPrefix + r.prepareName(name+".count")
+		r.sendDelta(key, deltaName, r.cumulativeDelta(key, deltaName, float64(count)), tags)
+	}
+}
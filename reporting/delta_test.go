@@ -0,0 +1,112 @@
+package reporting
+
+import (
+	"testing"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeltaCounters(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(), CustomRegistry(metrics.NewRegistry()),
+		DeltaCounters("requests.*")).(ExtendedMetricsReporter)
+
+	byPattern := metrics.NewCounter()
+	byOption := metrics.NewCounter()
+	plain := metrics.NewCounter()
+	reporter.RegisterMetric("requests.total", byPattern, nil)
+	reporter.GetOrRegisterMetricWithOptions("errors", byOption, nil, AsDelta())
+	reporter.RegisterMetric("plain", plain, nil)
+
+	deltas := func() map[string][]float64 {
+		res := map[string][]float64{}
+		for _, d := range sender.Deltas {
+			res[d.Name] = append(res[d.Name], d.Value)
+		}
+		return res
+	}
+
+	byPattern.Inc(10)
+	byOption.Inc(3)
+	plain.Inc(1)
+	reporter.Report()
+
+	byPattern.Inc(5)
+	byOption.Clear()
+	byOption.Inc(2)
+	reporter.Report()
+
+	reporter.Report()
+
+	assert.Equal(t, map[string][]float64{
+		deltaPrefix + "requests.total.count": {10, 5, 0},
+		deltaPrefix + "errors.count":         {3, 2, 0},
+	}, deltas())
+	assert.Equal(t, int64(15), byPattern.Count())
+	assert.Equal(t, int64(2), byOption.Count())
+	assert.Equal(t, byOption, reporter.GetMetric("errors", nil))
+
+	_, met, _ := sender.Counters()
+	assert.Equal(t, 3, met)
+
+	reporter.Close()
+}
+
+func TestEmbeddedDeltaCounts(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(), CustomRegistry(metrics.NewRegistry()),
+		EmbeddedCounts(CountsAsGaugesAndDeltas))
+
+	meter := metrics.NewMeter()
+	timer := metrics.NewTimer()
+	histogram := metrics.NewHistogram(metrics.NewUniformSample(100))
+	reporter.RegisterMetric("meter", meter, nil)
+	reporter.RegisterMetric("timer", timer, nil)
+	reporter.RegisterMetric("histogram", histogram, nil)
+
+	meter.Mark(3)
+	timer.Update(1)
+	histogram.Update(1)
+	reporter.Report()
+
+	meter.Mark(2)
+	timer.Update(1)
+	reporter.Report()
+
+	deltas := map[string][]float64{}
+	for _, d := range sender.Deltas {
+		deltas[d.Name] = append(deltas[d.Name], d.Value)
+	}
+	assert.Equal(t, map[string][]float64{
+		deltaPrefix + "meter.count":     {3, 2},
+		deltaPrefix + "timer.count":     {1, 1},
+		deltaPrefix + "histogram.count": {1, 0},
+	}, deltas)
+
+	counts := 0
+	for _, m := range sender.Metrics {
+		if m.Name == "meter.count" {
+			counts++
+			assert.Contains(t, []float64{3, 5}, m.Value)
+		}
+	}
+	assert.Equal(t, 2, counts)
+
+	reporter.Close()
+}
+
+func TestEmbeddedDeltaCountsOnly(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(), CustomRegistry(metrics.NewRegistry()),
+		EmbeddedCounts(CountsAsDeltas))
+
+	reporter.RegisterMetric("meter", metrics.NewMeter(), nil)
+	reporter.Report()
+
+	_, met, del := sender.Counters()
+	assert.Equal(t, 4, met)
+	assert.Equal(t, 1, del)
+
+	reporter.Close()
+}
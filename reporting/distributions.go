@@ -0,0 +1,168 @@
+package reporting
+
+import (
+	"sort"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/wavefronthq/wavefront-sdk-go/histogram"
+)
+
+// distributionQuantiles is the maximal number of quantiles of a go-metrics histogram or timer sent as centroids.
+// Their samples mix the values of the previous reporting cycles, so the quantiles are sent as centroids weighted
+// by the number of values recorded during the reporting cycle.
+const distributionQuantiles = 100
+
+// centroidsProvider is implemented by the histograms of this package able to return their
+// values as centroids, which are then used instead of the histogram samples.
+type centroidsProvider interface {
+	centroids() []histogram.Centroid
+}
+
+// HistogramsAsDistributions reports the go-metrics histograms and timers whose name matches one of
+// the given patterns (see path.Match) as Wavefront distributions, whose percentiles can be aggregated
+// across hosts. Without patterns, all the go-metrics histograms and timers are reported as distributions.
+// The quantiles of their samples are sent as centroids weighted by the number of values recorded during
+// the reporting cycle, with a minute granularity. The counts and the timers rates are still reported as metrics.
+func HistogramsAsDistributions(patterns ...string) Option {
+	return func(args *reporter) {
+		if len(patterns) == 0 {
+			patterns = []string{"*"}
+		}
+		args.distributionPatterns = append(args.distributionPatterns, patterns...)
+	}
+}
+
+// AsDistribution reports the registered go-metrics histogram or timer as a Wavefront distribution,
+// like the HistogramsAsDistributions option
+func AsDistribution() RegisterOption {
+	return func(st *seriesState) {
+		st.asDistribution = true
+	}
+}
+
+// asDistribution reports whether the go-metrics histogram or timer with the given key and name
+// must be reported as a distribution
+func (r *reporter) asDistribution(key, name string) bool {
+	for _, pattern := range r.distributionPatterns {
+		if pattern == "*" || matchName(pattern, name) {
+			return true
+		}
+	}
+
+	r.seriesMux.Lock()
+	defer r.seriesMux.Unlock()
+
+	return r.state(key).asDistribution
+}
+
+func (r *reporter) reportHistogramDistribution(key, name string, metric metrics.Histogram, tags map[string]string) {
+	h := metric.Snapshot()
+	var centroids histogram.Centroids
+	if p, ok := metric.(centroidsProvider); ok {
+		centroids = p.centroids()
+	} else if p, ok := metric.Sample().(centroidsProvider); ok {
+		centroids = p.centroids()
+	} else {
+		centroids = quantileCentroids(r.intervalCount(key, h.Count()), h.Percentiles, 1)
+	}
+	r.sendCentroids(name, centroids, tags)
+	r.reportCount(key, name, h.Count(), tags)
+}
+
+func (r *reporter) reportTimerDistribution(key, name string, metric metrics.Timer, tags map[string]string) {
+	t := metric.Snapshot()
+	du := float64(r.durationUnit)
+	var centroids histogram.Centroids
+	if p, ok := metric.(centroidsProvider); ok {
+		centroids = p.centroids()
+		for i := range centroids {
+			centroids[i].Value /= du
+		}
+	} else {
+		centroids = quantileCentroids(r.intervalCount(key, t.Count()), t.Percentiles, du)
+	}
+	r.sendCentroids(name, centroids, tags)
+	r.reportCount(key, name, t.Count(), tags)
+	r.errors <- r.sender.SendMetric(r.prepareName(name+".one-minute"), t.Rate1(), 0, r.source, tags)
+	r.errors <- r.sender.SendMetric(r.prepareName(name+".five-minute"), t.Rate5(), 0, r.source, tags)
+	r.errors <- r.sender.SendMetric(r.prepareName(name+".fifteen-minute"), t.Rate15(), 0, r.source, tags)
+	r.errors <- r.sender.SendMetric(r.prepareName(name+".mean-rate"), t.RateMean(), 0, r.source, tags)
+}
+
+// intervalCount returns the number of values recorded since the previous reporting cycle
+// by the go-metrics histogram or timer with the given key and count
+func (r *reporter) intervalCount(key string, count int64) int64 {
+	r.seriesMux.Lock()
+	defer r.seriesMux.Unlock()
+
+	st := r.state(key)
+	n := count - st.lastCount
+	if n < 0 {
+		// cleared since the previous cycle
+		n = count
+	}
+	st.lastCount = count
+	return n
+}
+
+// quantileCentroids returns evenly spaced quantiles, divided by the unit, as centroids sharing the given count,
+// at most distributionQuantiles of them
+func quantileCentroids(count int64, percentiles func([]float64) []float64, unit float64) histogram.Centroids {
+	k := int64(distributionQuantiles)
+	if count < k {
+		k = count
+	}
+	if k <= 0 {
+		return nil
+	}
+	ps := make([]float64, k)
+	for i := range ps {
+		ps[i] = (float64(i) + 0.5) / float64(k)
+	}
+	centroids := make(histogram.Centroids, k)
+	for i, v := range percentiles(ps) {
+		c := count / k
+		if int64(i) < count%k {
+			c++
+		}
+		centroids[i] = histogram.Centroid{Value: v / unit, Count: int(c)}
+	}
+	return centroids
+}
+
+// sendCentroids sends the given centroids as a distribution of the current minute
+func (r *reporter) sendCentroids(name string, centroids histogram.Centroids, tags map[string]string) {
+	centroids = centroids.Compact()
+	sort.Slice(centroids, func(i, j int) bool { return centroids[i].Value < centroids[j].Value })
+	distribution := histogram.Distribution{Centroids: centroids, Timestamp: time.Now()}
+	r.sendDistributions(name, []histogram.Distribution{distribution}, histogram.MINUTE, tags)
+}
+
+// DistributionStatistics reports, along with the distributions of the Wavefront histograms and timers, their count,
+// min, max, mean and percentiles as metrics. The statistics are computed from the distributions sent during the
+// reporting cycle, with the finest granularity, and are not reported when no distribution is sent.
+// The count of the timers is the count of their events, reported anyway.
+func DistributionStatistics(enable bool) Option {
+	return func(args *reporter) {
+		args.distributionStats = enable
+	}
+}
+
+// reportDistributionStats reports the statistics of the given distributions, and their count if requested
+func (r *reporter) reportDistributionStats(name string, distributions []histogram.Distribution, count bool, tags map[string]string) {
+	s := newHistogramSnapshot(distributions)
+	if s.Count() == 0 {
+		return
+	}
+	if count {
+		r.errors <- r.sender.SendMetric(r.prepareName(name+".count"), float64(s.Count()), 0, r.source, tags)
+	}
+	r.errors <- r.sender.SendMetric(r.prepareName(name+".min"), s.MinFloat64(), 0, r.source, tags)
+	r.errors <- r.sender.SendMetric(r.prepareName(name+".max"), s.MaxFloat64(), 0, r.source, tags)
+	r.errors <- r.sender.SendMetric(r.prepareName(name+".mean"), s.Mean(), 0, r.source, tags)
+	ps := s.Percentiles(r.percentiles)
+	for psIdx, psKey := range r.percentiles {
+		r.errors <- r.sender.SendMetric(r.prepareName(name+"."+percentileName(psKey)), ps[psIdx], 0, r.source, tags)
+	}
+}
@@ -0,0 +1,128 @@
+package reporting
+
+import (
+	"testing"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/wavefronthq/wavefront-sdk-go/histogram"
+)
+
+func TestHistogramsAsDistributions(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(), CustomRegistry(metrics.NewRegistry()),
+		HistogramsAsDistributions("sizes.*")).(ExtendedMetricsReporter)
+
+	byPattern := metrics.NewHistogram(metrics.NewUniformSample(100))
+	byOption := metrics.NewTimer()
+	plain := metrics.NewHistogram(metrics.NewUniformSample(100))
+	reporter.RegisterMetric("sizes.body", byPattern, nil)
+	reporter.RegisterMetricWithOptions("latency", byOption, nil, AsDistribution())
+	reporter.RegisterMetric("plain", plain, nil)
+
+	byPattern.Update(5)
+	byPattern.Update(1)
+	byPattern.Update(5)
+	plain.Update(1)
+	for i := 0; i < 10; i++ {
+		byOption.Update(20 * time.Millisecond)
+	}
+	reporter.Report()
+
+	distributions := map[string][]histogram.Centroid{}
+	for _, d := range sender.Distributions {
+		assert.Equal(t, map[histogram.Granularity]bool{histogram.MINUTE: true}, d.Granularities)
+		distributions[d.Name] = d.Centroids
+	}
+	assert.Equal(t, map[string][]histogram.Centroid{
+		"sizes.body": {{Value: 1, Count: 1}, {Value: 5, Count: 2}},
+		"latency":    {{Value: float64(20 * time.Millisecond), Count: 10}},
+	}, distributions)
+
+	names := map[string]bool{}
+	for _, m := range sender.Metrics {
+		names[m.Name] = true
+	}
+	assert.True(t, names["sizes.body.count"])
+	assert.False(t, names["sizes.body.mean"])
+	assert.True(t, names["latency.count"])
+	assert.True(t, names["latency.one-minute"])
+	assert.False(t, names["latency.50-percentile"])
+	assert.True(t, names["plain.50-percentile"])
+
+	// only the values of the reporting cycle are sent
+	sender.Distributions = nil
+	reporter.Report()
+	assert.Empty(t, sender.Distributions)
+	byPattern.Update(7)
+	for i := 0; i < 1000; i++ {
+		byOption.Update(time.Duration(i) * time.Millisecond)
+	}
+	reporter.Report()
+	counts := map[string]int{}
+	for _, d := range sender.Distributions {
+		for _, c := range d.Centroids {
+			counts[d.Name] += c.Count
+		}
+		if d.Name == "latency" {
+			assert.True(t, len(d.Centroids) <= distributionQuantiles)
+		}
+	}
+	assert.Equal(t, map[string]int{"sizes.body": 1, "latency": 1000}, counts)
+
+	reporter.Close()
+}
+
+func TestAllHistogramsAsDistributions(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(), CustomRegistry(metrics.NewRegistry()),
+		HistogramsAsDistributions())
+
+	h := metrics.NewHistogram(metrics.NewExpDecaySample(1028, 0.015))
+	reporter.RegisterMetric("api/sizes", h, nil)
+	reporter.RegisterMetric("empty", metrics.NewTimer(), nil)
+	h.Update(3)
+	reporter.Report()
+
+	if assert.Equal(t, 1, len(sender.Distributions)) {
+		assert.Equal(t, "api/sizes", sender.Distributions[0].Name)
+		assert.Equal(t, []histogram.Centroid{{Value: 3, Count: 1}}, sender.Distributions[0].Centroids)
+	}
+
+	reporter.Close()
+}
+
+func TestDistributionStatistics(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(), CustomRegistry(metrics.NewRegistry()),
+		DistributionStatistics(true), Prefix("app"))
+
+	clock := &testClock{now: time.Now()}
+	h := NewHistogram(histogram.TimeSupplier(clock.Now), histogram.GranularityOption(histogram.MINUTE),
+		histogram.GranularityOption(histogram.HOUR))
+	reporter.RegisterMetric("h", h, map[string]string{"k": "v"})
+
+	reporter.Report()
+	assert.Empty(t, sender.Metrics)
+
+	for i := 1; i <= 4; i++ {
+		h.Update(int64(i))
+	}
+	clock.Add(time.Minute)
+	reporter.Report()
+
+	values := map[string]float64{}
+	for _, m := range sender.Metrics {
+		assert.Equal(t, map[string]string{"k": "v"}, m.Tags)
+		values[m.Name] = m.Value
+	}
+	assert.Equal(t, map[string]float64{
+		"app.h.count": 4, "app.h.min": 1, "app.h.max": 4, "app.h.mean": 2.5,
+		"app.h.50-percentile": 2.5, "app.h.75-percentile": 3.75, "app.h.95-percentile": 4,
+		"app.h.99-percentile": 4, "app.h.999-percentile": 4,
+	}, values)
+	assert.Equal(t, 1, len(sender.Distributions))
+
+	reporter.Close()
+}
@@ -0,0 +1,128 @@
+package reporting
+
+import (
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// ExpireCallback is called with every series unregistered after being idle for too long
+type ExpireCallback func(name string, tags map[string]string, metric interface{})
+
+type expiryRule struct {
+	pattern   string
+	intervals int
+}
+
+// ExpireIdle unregisters the series whose value has not changed, and which have not been
+// accessed through the reporter, during the given number of reporting intervals.
+// A number of intervals of 0 (the default) never expires series.
+func ExpireIdle(intervals int) Option {
+	return func(args *reporter) {
+		args.expireIdle = intervals
+	}
+}
+
+// ExpireIdlePattern overrides the ExpireIdle number of intervals for the metric names
+// matching the given pattern (see path.Match). The first matching pattern applies.
+func ExpireIdlePattern(pattern string, intervals int) Option {
+	return func(args *reporter) {
+		args.expireRules = append(args.expireRules, expiryRule{pattern: pattern, intervals: intervals})
+	}
+}
+
+// OnExpire sets a callback called for every expired series.
+// The callback is called during the reporting cycle and must not call Report.
+func OnExpire(callback ExpireCallback) Option {
+	return func(args *reporter) {
+		args.onExpire = callback
+	}
+}
+
+func (r *reporter) expiryEnabled() bool {
+	return r.expireIdle > 0 || len(r.expireRules) > 0
+}
+
+// idleIntervals returns after how many idle intervals the series of the given metric name expire
+func (r *reporter) idleIntervals(name string) int {
+	for _, rule := range r.expireRules {
+		if matchName(rule.pattern, name) {
+			return rule.intervals
+		}
+	}
+	return r.expireIdle
+}
+
+// touch resets the idle intervals count of the series with the given key
+func (r *reporter) touch(key string) {
+	if !r.expiryEnabled() {
+		return
+	}
+
+	r.seriesMux.Lock()
+	defer r.seriesMux.Unlock()
+
+	if st, ok := r.series[key]; ok {
+		st.idle = 0
+	}
+}
+
+// idle updates the idle intervals count of a series and returns true if the series has expired.
+// Must be called with r.seriesMux held.
+func (r *reporter) idle(st *seriesState, name string, metric interface{}) bool {
+	if !r.expiryEnabled() {
+		return false
+	}
+
+	fingerprint, active := fingerprint(name, metric)
+	if active || fingerprint != st.fingerprint || len(st.pending) > 0 {
+		st.fingerprint = fingerprint
+		st.idle = 0
+		return false
+	}
+	st.idle++
+
+	intervals := r.idleIntervals(name)
+	return intervals > 0 && st.idle >= intervals
+}
+
+// expire unregisters an idle series and notifies the expiry callback
+func (r *reporter) expire(key string, metric interface{}) {
+	r.unregister(key)
+	if r.onExpire != nil {
+		name, tags := DecodeKey(key)
+		r.onExpire(name, tags, metric)
+	}
+}
+
+// fingerprint returns a comparable value that changes when the metric is updated,
+// and true if the metric is known to have been updated since the last reporting cycle.
+func fingerprint(name string, metric interface{}) (interface{}, bool) {
+	switch m := metric.(type) {
+	case metrics.Counter:
+		if hasDeltaPrefix(name) {
+			return nil, m.Count() != 0
+		}
+		return m.Count(), false
+	case CounterFloat64:
+		if hasDeltaPrefix(name) {
+			return nil, m.Count() != 0
+		}
+		return m.Count(), false
+	case metrics.Gauge:
+		return m.Value(), false
+	case metrics.GaugeFloat64:
+		return m.Value(), false
+	case Histogram:
+		return m.updated(), false
+	case metrics.Histogram:
+		return m.Count(), false
+	case metrics.Meter:
+		return m.Count(), false
+	case metrics.Timer:
+		return m.Count(), false
+	case *BucketHistogram:
+		return [2]float64{float64(m.Count()), m.Sum()}, false
+	case *TopK:
+		return m.updated(), false
+	}
+	return nil, true
+}
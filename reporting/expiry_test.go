@@ -0,0 +1,81 @@
+package reporting
+
+import (
+	"testing"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpireIdle(t *testing.T) {
+	var expired []string
+	reporter := NewMetricsReporter(newMockSender(), DisableAutoStart(), CustomRegistry(metrics.NewRegistry()),
+		ExpireIdle(2), ExpireIdlePattern("pods.*", 1), ExpireIdlePattern("static.*", 0),
+		OnExpire(func(name string, tags map[string]string, metric interface{}) {
+			expired = append(expired, name+"/"+tags["pod"])
+		}))
+
+	tags := map[string]string{"pod": "a"}
+	active := metrics.NewCounter()
+	idle := metrics.NewCounter()
+	touched := metrics.NewCounter()
+	reporter.RegisterMetric("active", active, tags)
+	reporter.RegisterMetric("idle", idle, tags)
+	reporter.RegisterMetric("touched", touched, tags)
+	reporter.RegisterMetric("pods.cpu", metrics.NewGauge(), tags)
+	reporter.RegisterMetric("static.gauge", metrics.NewGauge(), tags)
+
+	for i := 0; i < 4; i++ {
+		active.Inc(1)
+		reporter.GetMetric("touched", tags)
+		reporter.Report()
+	}
+
+	assert.Equal(t, []string{"pods.cpu/a", "idle/a"}, expired)
+	assert.Nil(t, reporter.GetMetric("idle", tags))
+	assert.Nil(t, reporter.GetMetric("pods.cpu", tags))
+	assert.NotNil(t, reporter.GetMetric("active", tags))
+	assert.NotNil(t, reporter.GetMetric("touched", tags))
+	assert.NotNil(t, reporter.GetMetric("static.gauge", tags))
+
+	reporter.Close()
+}
+
+func TestExpireIdleDelta(t *testing.T) {
+	reporter := NewMetricsReporter(newMockSender(), DisableAutoStart(), CustomRegistry(metrics.NewRegistry()), ExpireIdle(1))
+
+	counter := metrics.NewCounter()
+	reporter.RegisterMetric(DeltaCounterName("delta"), counter, nil)
+
+	for i := 0; i < 3; i++ {
+		counter.Inc(10)
+		reporter.Report()
+	}
+	assert.NotNil(t, reporter.GetMetric(DeltaCounterName("delta"), nil))
+
+	reporter.Report()
+	reporter.Report()
+	assert.Nil(t, reporter.GetMetric(DeltaCounterName("delta"), nil))
+
+	reporter.Close()
+}
+
+func TestExpireIdleHistogram(t *testing.T) {
+	reporter := NewMetricsReporter(newMockSender(), DisableAutoStart(), CustomRegistry(metrics.NewRegistry()), ExpireIdle(3))
+
+	active := NewHistogram()
+	idle := NewHistogram()
+	reporter.RegisterMetric("active", active, nil)
+	reporter.RegisterMetric("idle", idle, nil)
+	idle.Update(1)
+
+	// the values stay in the current bin of the minute, the reported distributions are empty
+	for i := 0; i < 5; i++ {
+		active.Update(int64(i))
+		reporter.Report()
+	}
+	assert.NotNil(t, reporter.GetMetric("active", nil))
+	assert.Nil(t, reporter.GetMetric("idle", nil))
+
+	reporter.Close()
+}
@@ -0,0 +1,521 @@
+package reporting
+
+import (
+	"math"
+	"sync"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/wavefronthq/wavefront-sdk-go/histogram"
+)
+
+const (
+	// DefaultExponentialHistogramSize is the default maximum number of buckets of the positive,
+	// and of the negative, values of an ExponentialHistogram
+	DefaultExponentialHistogramSize = 160
+
+	expMaxScale = 20
+	expMinScale = -10
+)
+
+// ExponentialHistogram is a metrics.Histogram counting its values in buckets whose boundaries are
+// powers of base = 2^(2^-scale), like the OpenTelemetry exponential histograms: the bucket of index i
+// counts the values in (base^i, base^(i+1)]. The scale starts at its highest precision and is lowered
+// whenever the values do not fit in the maximum number of buckets, so the histogram stays small and
+// its relative error is bounded by the scale. Histograms can be merged.
+// Reported as a distribution (see HistogramsAsDistributions), the values recorded during every
+// reporting cycle are sent.
+type ExponentialHistogram struct {
+	mutex    sync.Mutex
+	maxSize  int
+	data     expData
+	reported expData // values already sent as distributions
+}
+
+type expData struct {
+	scale     int
+	zeroCount uint64
+	positive  expBuckets
+	negative  expBuckets // buckets of the absolute values
+	count     uint64
+	sum       float64
+	min       float64
+	max       float64
+}
+
+type expBuckets struct {
+	offset int32 // index of the first bucket
+	counts []uint64
+}
+
+// NewExponentialHistogram creates an ExponentialHistogram keeping at most the given number of buckets
+// for the positive values, and for the negative values, or DefaultExponentialHistogramSize if the size is 0.
+func NewExponentialHistogram(maxSize int) metrics.Histogram {
+	if maxSize <= 0 {
+		maxSize = DefaultExponentialHistogramSize
+	}
+	if maxSize < 2 {
+		maxSize = 2
+	}
+	return &ExponentialHistogram{maxSize: maxSize, data: newExpData(), reported: newExpData()}
+}
+
+func newExpData() expData {
+	return expData{scale: expMaxScale}
+}
+
+// expIndex returns the index of the bucket of the given positive value at the given scale
+func expIndex(v float64, scale int) int32 {
+	frac, exp := math.Frexp(v)
+	exp-- // v = 1.x * 2^exp
+	if frac == 0.5 {
+		// exact power of two, at the upper boundary of its bucket
+		if scale <= 0 {
+			return int32((exp - 1) >> uint(-scale))
+		}
+		return int32(exp<<uint(scale)) - 1
+	}
+	if scale <= 0 {
+		return int32(exp >> uint(-scale))
+	}
+	return int32(math.Ceil(math.Log2(v)*math.Ldexp(1, scale))) - 1
+}
+
+// expLowerBoundary returns the lower boundary of the bucket of the given index at the given scale
+func expLowerBoundary(idx int32, scale int) float64 {
+	if scale <= 0 {
+		return math.Ldexp(1, int(idx)<<uint(-scale))
+	}
+	return math.Exp2(math.Ldexp(float64(idx), -scale))
+}
+
+// add counts values in the bucket of the given index, the buckets must fit
+func (b *expBuckets) add(idx int32, count uint64) {
+	if len(b.counts) == 0 {
+		b.offset = idx
+		b.counts = []uint64{count}
+		return
+	}
+	if idx < b.offset {
+		counts := make([]uint64, int(b.offset-idx)+len(b.counts))
+		copy(counts[b.offset-idx:], b.counts)
+		b.counts = counts
+		b.offset = idx
+	} else if last := b.offset + int32(len(b.counts)) - 1; idx > last {
+		b.counts = append(b.counts, make([]uint64, idx-last)...)
+	}
+	b.counts[idx-b.offset] += count
+}
+
+// sizeWith returns the number of buckets with the bucket of the given index, after downscaling by the given change
+func (b *expBuckets) sizeWith(idx int32, change uint) int {
+	low, high := idx>>change, idx>>change
+	if len(b.counts) > 0 {
+		if first := b.offset >> change; first < low {
+			low = first
+		}
+		if last := (b.offset + int32(len(b.counts)) - 1) >> change; last > high {
+			high = last
+		}
+	}
+	// the range of indexes can exceed int32 for values spanning the whole float64 range
+	return int(int64(high) - int64(low) + 1)
+}
+
+// downscale merges the buckets to a scale lowered by the given change
+func (b *expBuckets) downscale(change uint) {
+	if change == 0 || len(b.counts) == 0 {
+		return
+	}
+	merged := expBuckets{}
+	for i, count := range b.counts {
+		if count > 0 {
+			merged.add((b.offset+int32(i))>>change, count)
+		}
+	}
+	*b = merged
+}
+
+func (b expBuckets) copy() expBuckets {
+	return expBuckets{offset: b.offset, counts: append([]uint64{}, b.counts...)}
+}
+
+func (d *expData) buckets(v float64) *expBuckets {
+	if v > 0 {
+		return &d.positive
+	}
+	return &d.negative
+}
+
+// downscale lowers the scale of the data by the given change
+func (d *expData) downscale(change uint) {
+	d.positive.downscale(change)
+	d.negative.downscale(change)
+	d.scale -= int(change)
+}
+
+// fit returns by how much the scale must be lowered so the buckets of the given value fit in maxSize buckets
+func (d *expData) fit(b *expBuckets, idx int32, maxSize int) uint {
+	change := uint(0)
+	for d.scale-int(change) > expMinScale && b.sizeWith(idx, change) > maxSize {
+		change++
+	}
+	return change
+}
+
+func (d *expData) update(v float64, count uint64, maxSize int) {
+	if d.count == 0 || v < d.min {
+		d.min = v
+	}
+	if d.count == 0 || v > d.max {
+		d.max = v
+	}
+	d.count += count
+	d.sum += v * float64(count)
+
+	if v == 0 {
+		d.zeroCount += count
+		return
+	}
+	b := d.buckets(v)
+	abs := math.Abs(v)
+	if change := d.fit(b, expIndex(abs, d.scale), maxSize); change > 0 {
+		d.downscale(change)
+	}
+	b.add(expIndex(abs, d.scale), count)
+}
+
+// merge adds the values of the given data
+func (d *expData) merge(o expData, maxSize int) {
+	if o.count == 0 {
+		return
+	}
+	if o.scale < d.scale {
+		d.downscale(uint(d.scale - o.scale))
+	}
+	// lower the scale until the merged buckets fit
+	shift := uint(o.scale - d.scale)
+	change := uint(0)
+	for _, pair := range [][2]*expBuckets{{&d.positive, &o.positive}, {&d.negative, &o.negative}} {
+		b, ob := pair[0], pair[1]
+		if len(ob.counts) == 0 {
+			continue
+		}
+		low, high := ob.offset>>shift, (ob.offset+int32(len(ob.counts))-1)>>shift
+		if len(b.counts) > 0 {
+			if b.offset < low {
+				low = b.offset
+			}
+			if last := b.offset + int32(len(b.counts)) - 1; last > high {
+				high = last
+			}
+		}
+		for d.scale-int(change) > expMinScale && int64(high>>change)-int64(low>>change)+1 > int64(maxSize) {
+			change++
+		}
+	}
+	d.downscale(change)
+
+	shift = uint(o.scale - d.scale)
+	for _, pair := range [][2]*expBuckets{{&d.positive, &o.positive}, {&d.negative, &o.negative}} {
+		for i, count := range pair[1].counts {
+			if count > 0 {
+				pair[0].add((pair[1].offset+int32(i))>>shift, count)
+			}
+		}
+	}
+	if d.count == 0 || o.min < d.min {
+		d.min = o.min
+	}
+	if d.count == 0 || o.max > d.max {
+		d.max = o.max
+	}
+	d.count += o.count
+	d.sum += o.sum
+	d.zeroCount += o.zeroCount
+}
+
+// subtract removes the values of the given data, which must have been recorded before the values of d.
+// The min and max are kept.
+func (d expData) subtract(o expData) expData {
+	if o.scale < d.scale || o.count > d.count {
+		return d.copy()
+	}
+	o.positive, o.negative = o.positive.copy(), o.negative.copy()
+	o.downscale(uint(o.scale - d.scale))
+	res := expData{scale: d.scale, min: d.min, max: d.max, count: d.count - o.count, sum: d.sum - o.sum,
+		zeroCount: d.zeroCount - o.zeroCount}
+	for _, pair := range [][3]*expBuckets{{&res.positive, &d.positive, &o.positive}, {&res.negative, &d.negative, &o.negative}} {
+		for i, count := range pair[1].counts {
+			idx := pair[1].offset + int32(i)
+			if j := int(idx - pair[2].offset); j >= 0 && j < len(pair[2].counts) {
+				count -= pair[2].counts[j]
+			}
+			if count > 0 {
+				pair[0].add(idx, count)
+			}
+		}
+	}
+	return res
+}
+
+func (d expData) copy() expData {
+	d.positive = d.positive.copy()
+	d.negative = d.negative.copy()
+	return d
+}
+
+// Clear discards all the values of the histogram.
+func (h *ExponentialHistogram) Clear() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.data = newExpData()
+	h.reported = newExpData()
+}
+
+// Count returns the number of values recorded.
+func (h *ExponentialHistogram) Count() int64 {
+	return h.snapshot().Count()
+}
+
+// Max returns the maximum value recorded.
+func (h *ExponentialHistogram) Max() int64 {
+	return h.snapshot().Max()
+}
+
+// Mean returns the mean of the values recorded.
+func (h *ExponentialHistogram) Mean() float64 {
+	return h.snapshot().Mean()
+}
+
+// Merge adds the values of the given histogram, lowering the scale if needed.
+func (h *ExponentialHistogram) Merge(other *ExponentialHistogram) {
+	o := other.snapshot()
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.data.merge(o.data, h.maxSize)
+}
+
+// Min returns the minimum value recorded.
+func (h *ExponentialHistogram) Min() int64 {
+	return h.snapshot().Min()
+}
+
+// Percentile returns an arbitrary percentile of the values recorded.
+func (h *ExponentialHistogram) Percentile(p float64) float64 {
+	return h.snapshot().Percentile(p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the values recorded.
+func (h *ExponentialHistogram) Percentiles(ps []float64) []float64 {
+	return h.snapshot().Percentiles(ps)
+}
+
+// Sample returns a read-only metrics.Sample of the values recorded.
+func (h *ExponentialHistogram) Sample() metrics.Sample {
+	return h.snapshot().Sample()
+}
+
+// Scale returns the current scale of the histogram.
+func (h *ExponentialHistogram) Scale() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.data.scale
+}
+
+// Snapshot returns a read-only copy of the histogram.
+func (h *ExponentialHistogram) Snapshot() metrics.Histogram {
+	return h.snapshot()
+}
+
+func (h *ExponentialHistogram) snapshot() *ExponentialHistogramSnapshot {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return &ExponentialHistogramSnapshot{data: h.data.copy()}
+}
+
+// StdDev returns the standard deviation of the values recorded.
+func (h *ExponentialHistogram) StdDev() float64 {
+	return h.snapshot().StdDev()
+}
+
+// Sum returns the sum of the values recorded.
+func (h *ExponentialHistogram) Sum() int64 {
+	return h.snapshot().Sum()
+}
+
+// SumFloat64 returns the sum of the values recorded.
+func (h *ExponentialHistogram) SumFloat64() float64 {
+	return h.snapshot().SumFloat64()
+}
+
+// Update records a value.
+func (h *ExponentialHistogram) Update(v int64) {
+	h.UpdateFloat64(float64(v))
+}
+
+// UpdateFloat64 records a value, without truncating it.
+func (h *ExponentialHistogram) UpdateFloat64(v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.data.update(v, 1, h.maxSize)
+}
+
+// Variance returns the variance of the values recorded.
+func (h *ExponentialHistogram) Variance() float64 {
+	return h.snapshot().Variance()
+}
+
+// centroids returns the values recorded since the previous call, as the middle values of the buckets
+func (h *ExponentialHistogram) centroids() []histogram.Centroid {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	interval := h.data.subtract(h.reported)
+	h.reported = h.data.copy()
+	return (&ExponentialHistogramSnapshot{data: interval}).centroids()
+}
+
+// ExponentialHistogramSnapshot is a read-only copy of an ExponentialHistogram.
+type ExponentialHistogramSnapshot struct {
+	data expData
+}
+
+// Clear panics.
+func (*ExponentialHistogramSnapshot) Clear() {
+	panic("Clear called on an ExponentialHistogramSnapshot")
+}
+
+// Count returns the number of values at the time the snapshot was taken.
+func (s *ExponentialHistogramSnapshot) Count() int64 { return int64(s.data.count) }
+
+// Max returns the maximum value at the time the snapshot was taken.
+func (s *ExponentialHistogramSnapshot) Max() int64 { return int64(s.data.max) }
+
+// Mean returns the mean value at the time the snapshot was taken.
+func (s *ExponentialHistogramSnapshot) Mean() float64 {
+	if s.data.count == 0 {
+		return 0
+	}
+	return s.data.sum / float64(s.data.count)
+}
+
+// Min returns the minimum value at the time the snapshot was taken.
+func (s *ExponentialHistogramSnapshot) Min() int64 { return int64(s.data.min) }
+
+// Percentile returns an arbitrary percentile of the values at the time the snapshot was taken.
+func (s *ExponentialHistogramSnapshot) Percentile(p float64) float64 {
+	return s.Percentiles([]float64{p})[0]
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the values at the time the snapshot was taken.
+// Every percentile is the middle value of the bucket of the value at its rank, except for the lowest and
+// highest ranks which are the min and max values.
+func (s *ExponentialHistogramSnapshot) Percentiles(ps []float64) []float64 {
+	scores := make([]float64, len(ps))
+	if s.data.count == 0 {
+		return scores
+	}
+	centroids := s.centroids()
+	for i, p := range ps {
+		rank := uint64(math.Max(1, math.Ceil(math.Min(p, 1)*float64(s.data.count))))
+		if rank == 1 {
+			scores[i] = s.data.min
+			continue
+		} else if rank == s.data.count {
+			scores[i] = s.data.max
+			continue
+		}
+		var total uint64
+		for _, c := range centroids {
+			total += uint64(c.Count)
+			if total >= rank {
+				scores[i] = c.Value
+				break
+			}
+		}
+	}
+	return scores
+}
+
+// Sample returns a read-only metrics.Sample with the middle values of the buckets,
+// each value repeated as many times as the bucket count.
+func (s *ExponentialHistogramSnapshot) Sample() metrics.Sample {
+	values := make([]int64, 0, s.data.count)
+	for _, c := range s.centroids() {
+		for i := 0; i < c.Count; i++ {
+			values = append(values, int64(c.Value))
+		}
+	}
+	return metrics.NewSampleSnapshot(int64(s.data.count), values)
+}
+
+// Scale returns the scale of the histogram at the time the snapshot was taken.
+func (s *ExponentialHistogramSnapshot) Scale() int { return s.data.scale }
+
+// Snapshot returns the snapshot.
+func (s *ExponentialHistogramSnapshot) Snapshot() metrics.Histogram { return s }
+
+// StdDev returns the standard deviation of the values at the time the snapshot was taken.
+func (s *ExponentialHistogramSnapshot) StdDev() float64 {
+	return math.Sqrt(s.Variance())
+}
+
+// Sum returns the sum of the values at the time the snapshot was taken.
+func (s *ExponentialHistogramSnapshot) Sum() int64 { return int64(s.data.sum) }
+
+// SumFloat64 returns the sum of the values at the time the snapshot was taken.
+func (s *ExponentialHistogramSnapshot) SumFloat64() float64 { return s.data.sum }
+
+// Update panics.
+func (*ExponentialHistogramSnapshot) Update(int64) {
+	panic("Update called on an ExponentialHistogramSnapshot")
+}
+
+// Variance returns the variance of the values at the time the snapshot was taken,
+// computed with the middle values of the buckets.
+func (s *ExponentialHistogramSnapshot) Variance() float64 {
+	if s.data.count == 0 {
+		return 0
+	}
+	m := s.Mean()
+	var sum float64
+	for _, c := range s.centroids() {
+		d := c.Value - m
+		sum += d * d * float64(c.Count)
+	}
+	return sum / float64(s.data.count)
+}
+
+// centroids returns the middle values of the non empty buckets with their counts, sorted by value.
+// The middle values are bounded by the min and max values.
+func (s *ExponentialHistogramSnapshot) centroids() []histogram.Centroid {
+	d := s.data
+	var centroids []histogram.Centroid
+	middle := func(idx int32) float64 {
+		lower := expLowerBoundary(idx, d.scale)
+		upper := expLowerBoundary(idx+1, d.scale)
+		return lower + (upper-lower)/2
+	}
+	bounded := func(v float64) float64 {
+		return math.Min(math.Max(v, d.min), d.max)
+	}
+	for i := len(d.negative.counts) - 1; i >= 0; i-- {
+		if count := d.negative.counts[i]; count > 0 {
+			v := -middle(d.negative.offset + int32(i))
+			centroids = append(centroids, histogram.Centroid{Value: bounded(v), Count: int(count)})
+		}
+	}
+	if d.zeroCount > 0 {
+		centroids = append(centroids, histogram.Centroid{Value: 0, Count: int(d.zeroCount)})
+	}
+	for i, count := range d.positive.counts {
+		if count > 0 {
+			v := middle(d.positive.offset + int32(i))
+			centroids = append(centroids, histogram.Centroid{Value: bounded(v), Count: int(count)})
+		}
+	}
+	return centroids
+}
@@ -0,0 +1,133 @@
+package reporting
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpIndex(t *testing.T) {
+	assert.Equal(t, []int32{-1, 0, 1, 1, 2}, []int32{expIndex(1, 0), expIndex(2, 0), expIndex(3, 0), expIndex(4, 0), expIndex(5, 0)})
+	assert.Equal(t, int32(1), expIndex(2, 1))
+	assert.Equal(t, int32(0), expIndex(16, -2))
+	assert.Equal(t, int32(1), expIndex(17, -2))
+
+	r := rand.New(rand.NewSource(1))
+	for _, scale := range []int{-4, -1, 0, 1, 3, 8, 20} {
+		for i := 0; i < 1000; i++ {
+			v := math.Exp(r.Float64()*40 - 20)
+			idx := expIndex(v, scale)
+			assert.True(t, expLowerBoundary(idx, scale) < v*(1+1e-12), "scale %d value %v", scale, v)
+			assert.True(t, v <= expLowerBoundary(idx+1, scale)*(1+1e-12), "scale %d value %v", scale, v)
+		}
+	}
+}
+
+func TestExponentialHistogram(t *testing.T) {
+	h := NewExponentialHistogram(0).(*ExponentialHistogram)
+	assert.Equal(t, expMaxScale, h.Scale())
+
+	for i := 1; i <= 10000; i++ {
+		h.Update(int64(i))
+	}
+	assert.Equal(t, int64(10000), h.Count())
+	assert.Equal(t, int64(1), h.Min())
+	assert.Equal(t, int64(10000), h.Max())
+	assert.Equal(t, int64(50005000), h.Sum())
+	assert.Equal(t, 5000.5, h.Mean())
+
+	// 1 to 10000 fit in 160 buckets with a base of 2^(2^-3)
+	assert.Equal(t, 3, h.Scale())
+	relativeError := math.Exp2(math.Ldexp(1, -h.Scale())) - 1
+	for _, p := range []float64{0.5, 0.75, 0.99, 0.999} {
+		assert.InEpsilon(t, p*10000, h.Percentile(p), relativeError, "percentile %v", p)
+	}
+	assert.InEpsilon(t, metrics.SampleStdDev(h.Sample().Values()), h.StdDev(), 1e-4)
+
+	h.UpdateFloat64(-2.5)
+	h.UpdateFloat64(0)
+	assert.Equal(t, int64(-2), h.Min())
+	assert.Equal(t, -2.5, h.Percentile(0))
+	assert.Equal(t, 0.0, h.Percentile(0.0001))
+	assert.Equal(t, 10000.0, h.Percentile(1))
+
+	h.Clear()
+	assert.Equal(t, int64(0), h.Count())
+	assert.Equal(t, expMaxScale, h.Scale())
+}
+
+func TestExponentialHistogramMerge(t *testing.T) {
+	all := NewExponentialHistogram(20).(*ExponentialHistogram)
+	small := NewExponentialHistogram(20).(*ExponentialHistogram)
+	large := NewExponentialHistogram(20).(*ExponentialHistogram)
+	for i := 1; i <= 100; i++ {
+		all.Update(int64(i))
+		small.Update(int64(i))
+	}
+	for i := 1000000; i <= 1000100; i++ {
+		all.Update(int64(i))
+		large.Update(int64(i))
+	}
+	assert.True(t, large.Scale() > small.Scale())
+
+	small.Merge(large)
+	assert.Equal(t, all.Snapshot(), small.Snapshot())
+	assert.Equal(t, int64(101), large.Count())
+}
+
+func TestExponentialHistogramExtremeValues(t *testing.T) {
+	h := NewExponentialHistogram(0).(*ExponentialHistogram)
+	h.UpdateFloat64(5e-324)
+	h.UpdateFloat64(1e308)
+	assert.Equal(t, int64(2), h.Count())
+	assert.Equal(t, 1e308, h.Percentile(1))
+
+	// merging extreme values into a histogram still at the highest scale
+	low := NewExponentialHistogram(0).(*ExponentialHistogram)
+	high := NewExponentialHistogram(0).(*ExponentialHistogram)
+	low.UpdateFloat64(5e-324)
+	high.UpdateFloat64(1e308)
+	low.Merge(high)
+	assert.Equal(t, int64(2), low.Count())
+	assert.Equal(t, h.Scale(), low.Scale())
+}
+
+func TestReportExponentialHistogram(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(), CustomRegistry(metrics.NewRegistry()),
+		HistogramsAsDistributions("distribution"))
+
+	percentiles := NewExponentialHistogram(0)
+	distribution := NewExponentialHistogram(0)
+	reporter.RegisterMetric("percentiles", percentiles, nil)
+	reporter.RegisterMetric("distribution", distribution, nil)
+
+	percentiles.Update(8)
+	distribution.Update(8)
+	distribution.Update(8)
+	reporter.Report()
+	distribution.Update(1000)
+	reporter.Report()
+
+	values := map[string]float64{}
+	for _, m := range sender.Metrics {
+		values[m.Name] = m.Value
+	}
+	assert.Equal(t, 8.0, values["percentiles.max"])
+	assert.Equal(t, 8.0, values["percentiles.99-percentile"])
+	assert.Equal(t, 3.0, values["distribution.count"])
+
+	if assert.Equal(t, 2, len(sender.Distributions)) {
+		assert.Equal(t, 1, len(sender.Distributions[0].Centroids))
+		assert.Equal(t, 8.0, sender.Distributions[0].Centroids[0].Value)
+		assert.Equal(t, 2, sender.Distributions[0].Centroids[0].Count)
+		assert.Equal(t, 1, len(sender.Distributions[1].Centroids))
+		assert.InEpsilon(t, 1000.0, sender.Distributions[1].Centroids[0].Value, 1e-5)
+		assert.Equal(t, 1, sender.Distributions[1].Centroids[0].Count)
+	}
+
+	reporter.Close()
+}
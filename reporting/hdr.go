@@ -0,0 +1,408 @@
+package reporting
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/wavefronthq/wavefront-sdk-go/histogram"
+)
+
+// HDRHistogram is a metrics.Histogram recording its values in buckets, like the HdrHistogram
+// (see http://hdrhistogram.org), so its percentiles have a bounded relative error over a wide
+// range of values with a fixed memory. Its values are recorded without locks.
+// It keeps all the values recorded since it was created, IntervalSnapshot returns the values
+// recorded since its previous call. Reported as a distribution (see HistogramsAsDistributions),
+// the values recorded during every reporting cycle are sent.
+type HDRHistogram struct {
+	layout  *hdrLayout
+	counts  []int64
+	sum     int64
+	min     int64
+	max     int64
+	mutex   sync.Mutex // guards the interval baselines
+	last    hdrCounts  // baseline of IntervalSnapshot
+	centers hdrCounts  // baseline of the distributions reported
+}
+
+// hdrLayout maps the values to the buckets of a HDRHistogram
+type hdrLayout struct {
+	lowest                      int64
+	highest                     int64
+	unitMagnitude               uint
+	subBucketHalfCountMagnitude uint
+	subBucketCount              int64
+	subBucketHalfCount          int64
+	subBucketMask               int64
+	bucketCount                 int
+	countsLen                   int
+}
+
+type hdrCounts struct {
+	counts []int64
+	sum    int64
+}
+
+// NewHDRHistogram creates a HDRHistogram recording the values between lowest and highest, the values out
+// of this range are recorded as the lowest or highest value. The percentiles of the histogram have the given
+// number of significant figures, between 1 and 5.
+func NewHDRHistogram(lowest, highest int64, significantFigures int) metrics.Histogram {
+	if lowest < 1 {
+		lowest = 1
+	}
+	if highest < 2*lowest {
+		highest = 2 * lowest
+	}
+	if significantFigures < 1 {
+		significantFigures = 1
+	} else if significantFigures > 5 {
+		significantFigures = 5
+	}
+
+	l := &hdrLayout{lowest: lowest, highest: highest}
+	largestValueWithSingleUnitResolution := 2 * math.Pow10(significantFigures)
+	subBucketCountMagnitude := uint(math.Ceil(math.Log2(largestValueWithSingleUnitResolution)))
+	l.subBucketHalfCountMagnitude = subBucketCountMagnitude - 1
+	l.unitMagnitude = uint(math.Floor(math.Log2(float64(lowest))))
+	l.subBucketCount = 1 << (l.subBucketHalfCountMagnitude + 1)
+	l.subBucketHalfCount = l.subBucketCount / 2
+	l.subBucketMask = (l.subBucketCount - 1) << l.unitMagnitude
+
+	smallestUntrackableValue := l.subBucketCount << l.unitMagnitude
+	l.bucketCount = 1
+	for smallestUntrackableValue <= highest {
+		if smallestUntrackableValue > math.MaxInt64/2 {
+			l.bucketCount++
+			break
+		}
+		smallestUntrackableValue <<= 1
+		l.bucketCount++
+	}
+	l.countsLen = (l.bucketCount + 1) * int(l.subBucketHalfCount)
+
+	return &HDRHistogram{layout: l, counts: make([]int64, l.countsLen), min: math.MaxInt64, max: math.MinInt64}
+}
+
+// countsIndex returns the index of the bucket counting the given value
+func (l *hdrLayout) countsIndex(v int64) int {
+	pow2Ceiling := int64(64 - bits.LeadingZeros64(uint64(v|l.subBucketMask)))
+	bucketIdx := pow2Ceiling - int64(l.unitMagnitude) - int64(l.subBucketHalfCountMagnitude+1)
+	subBucketIdx := v >> uint(bucketIdx+int64(l.unitMagnitude))
+	return int((bucketIdx+1)<<l.subBucketHalfCountMagnitude + subBucketIdx - l.subBucketHalfCount)
+}
+
+// lowestValue returns the lowest value counted by the bucket of the given index, and the size of the range of
+// the values counted by the bucket
+func (l *hdrLayout) lowestValue(idx int) (int64, int64) {
+	bucketIdx := int64(idx>>l.subBucketHalfCountMagnitude) - 1
+	subBucketIdx := int64(idx)&(l.subBucketHalfCount-1) + l.subBucketHalfCount
+	if bucketIdx < 0 {
+		subBucketIdx -= l.subBucketHalfCount
+		bucketIdx = 0
+	}
+	return subBucketIdx << uint(bucketIdx+int64(l.unitMagnitude)), 1 << uint(bucketIdx+int64(l.unitMagnitude))
+}
+
+// highestValue returns the highest value counted by the bucket of the given index
+func (l *hdrLayout) highestValue(idx int) int64 {
+	lowest, size := l.lowestValue(idx)
+	return lowest + size - 1
+}
+
+// medianValue returns the value in the middle of the range of the values counted by the bucket of the given index
+func (l *hdrLayout) medianValue(idx int) int64 {
+	lowest, size := l.lowestValue(idx)
+	return lowest + size>>1
+}
+
+// Clear discards all the values of the histogram. The values recorded while it is cleared may be kept.
+func (h *HDRHistogram) Clear() {
+	for i := range h.counts {
+		atomic.StoreInt64(&h.counts[i], 0)
+	}
+	atomic.StoreInt64(&h.sum, 0)
+	atomic.StoreInt64(&h.min, math.MaxInt64)
+	atomic.StoreInt64(&h.max, math.MinInt64)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.last = hdrCounts{}
+	h.centers = hdrCounts{}
+}
+
+// Count returns the number of values recorded.
+func (h *HDRHistogram) Count() int64 {
+	return h.Snapshot().Count()
+}
+
+// Max returns the maximum value recorded.
+func (h *HDRHistogram) Max() int64 {
+	return h.Snapshot().Max()
+}
+
+// Mean returns the mean of the values recorded.
+func (h *HDRHistogram) Mean() float64 {
+	return h.Snapshot().Mean()
+}
+
+// Min returns the minimum value recorded.
+func (h *HDRHistogram) Min() int64 {
+	return h.Snapshot().Min()
+}
+
+// Percentile returns an arbitrary percentile of the values recorded.
+func (h *HDRHistogram) Percentile(p float64) float64 {
+	return h.Snapshot().Percentile(p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the values recorded.
+func (h *HDRHistogram) Percentiles(ps []float64) []float64 {
+	return h.Snapshot().Percentiles(ps)
+}
+
+// Sample returns a read-only metrics.Sample of the values recorded.
+func (h *HDRHistogram) Sample() metrics.Sample {
+	return h.Snapshot().Sample()
+}
+
+// Snapshot returns a read-only copy of the histogram.
+func (h *HDRHistogram) Snapshot() metrics.Histogram {
+	return h.snapshot(h.current())
+}
+
+// IntervalSnapshot returns a read-only copy of the values recorded since the previous call.
+func (h *HDRHistogram) IntervalSnapshot() metrics.Histogram {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.snapshot(h.interval(&h.last))
+}
+
+// current returns a copy of the counts of the histogram
+func (h *HDRHistogram) current() hdrCounts {
+	c := hdrCounts{counts: make([]int64, len(h.counts)), sum: atomic.LoadInt64(&h.sum)}
+	for i := range h.counts {
+		c.counts[i] = atomic.LoadInt64(&h.counts[i])
+	}
+	return c
+}
+
+// interval returns the counts recorded since the given baseline, and replaces the baseline with the current counts.
+// Must be called with h.mutex held.
+func (h *HDRHistogram) interval(baseline *hdrCounts) hdrCounts {
+	current := h.current()
+	res := hdrCounts{counts: make([]int64, len(current.counts)), sum: current.sum - baseline.sum}
+	for i, count := range current.counts {
+		res.counts[i] = count
+		if baseline.counts != nil {
+			res.counts[i] -= baseline.counts[i]
+		}
+	}
+	*baseline = current
+	return res
+}
+
+func (h *HDRHistogram) snapshot(c hdrCounts) *HDRHistogramSnapshot {
+	s := &HDRHistogramSnapshot{layout: h.layout, counts: c.counts, sum: c.sum}
+	first, last := -1, -1
+	for i, count := range c.counts {
+		if count > 0 {
+			if first < 0 {
+				first = i
+			}
+			last = i
+			s.count += count
+		}
+	}
+	if s.count > 0 {
+		// the recorded min and max are more precise than the buckets, when they belong to the same buckets
+		if min := atomic.LoadInt64(&h.min); h.layout.countsIndex(min) == first {
+			s.min = min
+		} else {
+			s.min, _ = h.layout.lowestValue(first)
+		}
+		s.max = h.layout.highestValue(last)
+		if max := atomic.LoadInt64(&h.max); h.layout.countsIndex(max) == last {
+			s.max = max
+		}
+	}
+	return s
+}
+
+// StdDev returns the standard deviation of the values recorded.
+func (h *HDRHistogram) StdDev() float64 {
+	return h.Snapshot().StdDev()
+}
+
+// Sum returns the sum of the values recorded.
+func (h *HDRHistogram) Sum() int64 {
+	return atomic.LoadInt64(&h.sum)
+}
+
+// Update records a value.
+func (h *HDRHistogram) Update(v int64) {
+	if v < h.layout.lowest {
+		v = h.layout.lowest
+	} else if v > h.layout.highest {
+		v = h.layout.highest
+	}
+	atomic.AddInt64(&h.counts[h.layout.countsIndex(v)], 1)
+	atomic.AddInt64(&h.sum, v)
+	for min := atomic.LoadInt64(&h.min); v < min && !atomic.CompareAndSwapInt64(&h.min, min, v); {
+		min = atomic.LoadInt64(&h.min)
+	}
+	for max := atomic.LoadInt64(&h.max); v > max && !atomic.CompareAndSwapInt64(&h.max, max, v); {
+		max = atomic.LoadInt64(&h.max)
+	}
+}
+
+// Variance returns the variance of the values recorded.
+func (h *HDRHistogram) Variance() float64 {
+	return h.Snapshot().Variance()
+}
+
+// centroids returns the values recorded since the previous call, as the middle values of the buckets
+func (h *HDRHistogram) centroids() []histogram.Centroid {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.snapshot(h.interval(&h.centers)).centroids()
+}
+
+// HDRHistogramSnapshot is a read-only copy of a HDRHistogram.
+type HDRHistogramSnapshot struct {
+	layout *hdrLayout
+	counts []int64
+	count  int64
+	sum    int64
+	min    int64
+	max    int64
+}
+
+// Clear panics.
+func (*HDRHistogramSnapshot) Clear() {
+	panic("Clear called on a HDRHistogramSnapshot")
+}
+
+// Count returns the number of values at the time the snapshot was taken.
+func (s *HDRHistogramSnapshot) Count() int64 { return s.count }
+
+// Max returns the maximum value at the time the snapshot was taken.
+func (s *HDRHistogramSnapshot) Max() int64 { return s.max }
+
+// Mean returns the mean value at the time the snapshot was taken.
+func (s *HDRHistogramSnapshot) Mean() float64 {
+	if s.count == 0 {
+		return 0
+	}
+	return float64(s.sum) / float64(s.count)
+}
+
+// Min returns the minimum value at the time the snapshot was taken.
+func (s *HDRHistogramSnapshot) Min() int64 { return s.min }
+
+// Percentile returns an arbitrary percentile of the values at the time the snapshot was taken.
+func (s *HDRHistogramSnapshot) Percentile(p float64) float64 {
+	return s.Percentiles([]float64{p})[0]
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the values at the time the snapshot was taken.
+// Every percentile is the highest value equivalent to the recorded value at its rank.
+func (s *HDRHistogramSnapshot) Percentiles(ps []float64) []float64 {
+	scores := make([]float64, len(ps))
+	if s.count == 0 {
+		return scores
+	}
+	for i, p := range ps {
+		rank := int64(math.Max(1, math.Ceil(math.Min(p, 1)*float64(s.count))))
+		var total int64
+		for idx, count := range s.counts {
+			total += count
+			if total >= rank {
+				scores[i] = float64(s.layout.highestValue(idx))
+				break
+			}
+		}
+		scores[i] = math.Min(math.Max(scores[i], float64(s.min)), float64(s.max))
+	}
+	return scores
+}
+
+// Sample returns a read-only metrics.Sample with the values at the time the snapshot was taken.
+func (s *HDRHistogramSnapshot) Sample() metrics.Sample {
+	return hdrSample{s}
+}
+
+// Snapshot returns the snapshot.
+func (s *HDRHistogramSnapshot) Snapshot() metrics.Histogram { return s }
+
+// StdDev returns the standard deviation of the values at the time the snapshot was taken.
+func (s *HDRHistogramSnapshot) StdDev() float64 {
+	return math.Sqrt(s.Variance())
+}
+
+// Sum returns the sum of the values at the time the snapshot was taken.
+func (s *HDRHistogramSnapshot) Sum() int64 { return s.sum }
+
+// Update panics.
+func (*HDRHistogramSnapshot) Update(int64) {
+	panic("Update called on a HDRHistogramSnapshot")
+}
+
+// Variance returns the variance of the values at the time the snapshot was taken,
+// computed with the middle values of the buckets.
+func (s *HDRHistogramSnapshot) Variance() float64 {
+	if s.count == 0 {
+		return 0
+	}
+	m := s.Mean()
+	var sum float64
+	for idx, count := range s.counts {
+		if count > 0 {
+			d := float64(s.layout.medianValue(idx)) - m
+			sum += d * d * float64(count)
+		}
+	}
+	return sum / float64(s.count)
+}
+
+// centroids returns the middle values of the non empty buckets, with their counts
+func (s *HDRHistogramSnapshot) centroids() []histogram.Centroid {
+	var centroids []histogram.Centroid
+	for idx, count := range s.counts {
+		if count > 0 {
+			centroids = append(centroids, histogram.Centroid{Value: float64(s.layout.medianValue(idx)), Count: int(count)})
+		}
+	}
+	return centroids
+}
+
+// hdrSample is the metrics.Sample of a HDRHistogramSnapshot, its values are the middle values of the buckets
+type hdrSample struct {
+	s *HDRHistogramSnapshot
+}
+
+func (hdrSample) Clear()                               { panic("Clear called on a HDRHistogramSnapshot sample") }
+func (h hdrSample) Count() int64                       { return h.s.Count() }
+func (h hdrSample) Max() int64                         { return h.s.Max() }
+func (h hdrSample) Mean() float64                      { return h.s.Mean() }
+func (h hdrSample) Min() int64                         { return h.s.Min() }
+func (h hdrSample) Percentile(p float64) float64       { return h.s.Percentile(p) }
+func (h hdrSample) Percentiles(ps []float64) []float64 { return h.s.Percentiles(ps) }
+func (h hdrSample) Size() int                          { return int(h.s.Count()) }
+func (h hdrSample) Snapshot() metrics.Sample           { return h }
+func (h hdrSample) StdDev() float64                    { return h.s.StdDev() }
+func (h hdrSample) Sum() int64                         { return h.s.Sum() }
+func (hdrSample) Update(int64)                         { panic("Update called on a HDRHistogramSnapshot sample") }
+func (h hdrSample) Variance() float64                  { return h.s.Variance() }
+
+// Values returns the middle value of the bucket of every recorded value, sorted.
+func (h hdrSample) Values() []int64 {
+	values := make([]int64, 0, h.s.count)
+	for idx, count := range h.s.counts {
+		for i := int64(0); i < count; i++ {
+			values = append(values, h.s.layout.medianValue(idx))
+		}
+	}
+	return values
+}
@@ -0,0 +1,108 @@
+package reporting
+
+import (
+	"sync"
+	"testing"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHDRHistogram(t *testing.T) {
+	h := NewHDRHistogram(1, 3600000000, 3)
+	for i := int64(1); i <= 100000; i++ {
+		h.Update(i)
+	}
+
+	assert.Equal(t, int64(100000), h.Count())
+	assert.Equal(t, int64(1), h.Min())
+	assert.Equal(t, int64(100000), h.Max())
+	assert.Equal(t, int64(5000050000), h.Sum())
+	assert.Equal(t, 50000.5, h.Mean())
+	for _, p := range []float64{0.5, 0.75, 0.9, 0.99, 0.999} {
+		assert.InEpsilon(t, p*100000, h.Percentile(p), 1e-3, "percentile %v", p)
+	}
+	assert.InEpsilon(t, metrics.SampleStdDev(h.Sample().Values()), h.StdDev(), 1e-3)
+
+	// low values are recorded exactly
+	small := NewHDRHistogram(1, 1000, 2)
+	small.Update(3)
+	small.Update(7)
+	small.Update(5000)
+	assert.Equal(t, []float64{3, 7, 1000}, small.Percentiles([]float64{0, 0.5, 1}))
+
+	h.Clear()
+	assert.Equal(t, int64(0), h.Count())
+	assert.Equal(t, 0.0, h.Percentile(0.5))
+}
+
+func TestHDRHistogramIntervalSnapshot(t *testing.T) {
+	h := NewHDRHistogram(1, 1000000, 3).(*HDRHistogram)
+	h.Update(10)
+	h.Update(20)
+	s := h.IntervalSnapshot()
+	assert.Equal(t, int64(2), s.Count())
+	assert.Equal(t, int64(30), s.Sum())
+
+	h.Update(500)
+	s = h.IntervalSnapshot()
+	assert.Equal(t, int64(1), s.Count())
+	assert.Equal(t, int64(500), s.Min())
+	assert.Equal(t, int64(500), s.Max())
+	assert.Equal(t, 500.0, s.Percentile(0.99))
+	assert.Equal(t, int64(3), h.Count())
+
+	assert.Equal(t, int64(0), h.IntervalSnapshot().Count())
+}
+
+func TestHDRHistogramConcurrentUpdates(t *testing.T) {
+	h := NewHDRHistogram(1, 1000000, 3)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(v int64) {
+			defer wg.Done()
+			for j := 0; j < 10000; j++ {
+				h.Update(v)
+			}
+		}(int64(i + 1))
+	}
+	wg.Wait()
+	assert.Equal(t, int64(40000), h.Count())
+	assert.Equal(t, int64(100000), h.Sum())
+	assert.Equal(t, int64(1), h.Min())
+	assert.Equal(t, int64(4), h.Max())
+}
+
+func TestReportHDRHistogram(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(), CustomRegistry(metrics.NewRegistry())).(ExtendedMetricsReporter)
+
+	percentiles := NewHDRHistogram(1, 1000000, 3)
+	distribution := NewHDRHistogram(1, 1000000, 3)
+	reporter.RegisterMetric("percentiles", percentiles, nil)
+	reporter.RegisterMetricWithOptions("distribution", distribution, nil, AsDistribution())
+
+	percentiles.Update(42)
+	distribution.Update(42)
+	distribution.Update(42)
+	reporter.Report()
+	distribution.Update(7)
+	reporter.Report()
+
+	values := map[string]float64{}
+	for _, m := range sender.Metrics {
+		values[m.Name] = m.Value
+	}
+	assert.Equal(t, 42.0, values["percentiles.99-percentile"])
+	assert.Equal(t, 3.0, values["distribution.count"])
+
+	if assert.Equal(t, 2, len(sender.Distributions)) {
+		assert.Equal(t, 42.0, sender.Distributions[0].Centroids[0].Value)
+		assert.Equal(t, 2, sender.Distributions[0].Centroids[0].Count)
+		assert.Equal(t, 7.0, sender.Distributions[1].Centroids[0].Value)
+		assert.Equal(t, 1, sender.Distributions[1].Centroids[0].Count)
+	}
+
+	reporter.Close()
+}
@@ -1,110 +1,356 @@
 package reporting
 
 import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	metrics "github.com/rcrowley/go-metrics"
 	"github.com/wavefronthq/wavefront-sdk-go/histogram"
 )
 
 // Histogram wrapper of Wavefront Histogram so it can be used with metrics.Registry
 type Histogram struct {
-	delegate histogram.Histogram
+	h *wavefrontHistogram
+}
+
+type wavefrontHistogram struct {
+	updates       int64 // number of updates and merges, to detect idle histograms; first for its 64-bit alignment
+	mux           sync.RWMutex
+	clock         func() time.Time
+	options       []histogram.Option
+	granularities []histogram.Granularity
+	delegates     []histogram.Histogram                              // one per granularity, the finest first
+	complete      func()                                             // completes the current time slices of the delegates
+	customClock   bool                                               // set by a histogram.TimeSupplier option
+	pending       map[histogram.Granularity][]histogram.Distribution // flushed or merged from other histograms, not reported yet
 }
 
-// NewHistogram create a new Wavefront Histogram and the wrapper
+// ErrCustomTimeSupplier is returned by Flush for the histograms created with a histogram.TimeSupplier option
+var ErrCustomTimeSupplier = errors.New("cannot flush a histogram created with a histogram.TimeSupplier option")
+
+// NewHistogram create a new Wavefront Histogram and the wrapper.
+// Several histogram.GranularityOption can be given to report the histogram distributions
+// with each of the granularities, the statistics of the histogram are computed with the finest one.
+// Flush cannot force out the current bins of the histograms which set a histogram.TimeSupplier.
 func NewHistogram(options ...histogram.Option) metrics.Histogram {
-	return Histogram{delegate: histogram.New(options...)}
+	return newHistogram(time.Now, options...)
+}
+
+func newHistogram(clock func() time.Time, options ...histogram.Option) Histogram {
+	h := &wavefrontHistogram{clock: clock}
+	h.granularities, h.options = granularities(options)
+	for _, option := range h.options {
+		h.customClock = h.customClock || setsTimeSupplier(option)
+	}
+	h.delegates, h.complete = h.newDelegates()
+	return Histogram{h: h}
+}
+
+// granularities splits the given options into the granularities they set, the finest first,
+// and the other options.
+func granularities(options []histogram.Option) ([]histogram.Granularity, []histogram.Option) {
+	var gs []histogram.Granularity
+	var others []histogram.Option
+	set := make(map[histogram.Granularity]bool)
+	for _, option := range options {
+		// an option setting the granularity overrides any previous one
+		hour := histogram.New(histogram.GranularityOption(histogram.HOUR), option).Granularity()
+		day := histogram.New(histogram.GranularityOption(histogram.DAY), option).Granularity()
+		if hour != day {
+			others = append(others, option)
+		} else if !set[hour] {
+			set[hour] = true
+			gs = append(gs, hour)
+		}
+	}
+	if len(gs) == 0 {
+		gs = append(gs, histogram.New().Granularity())
+	}
+	sort.Slice(gs, func(i, j int) bool { return gs[i] < gs[j] })
+	return gs, others
+}
+
+// setsTimeSupplier reports whether the option sets a histogram.TimeSupplier, which overrides the supplier of the probe
+func setsTimeSupplier(option histogram.Option) bool {
+	called := false
+	probe := histogram.New(histogram.TimeSupplier(func() time.Time {
+		called = true
+		return time.Time{}
+	}), option)
+	probe.Count()
+	return !called
+}
+
+// newDelegates creates a delegate per granularity, and the function completing their current time slices
+// by moving their own clock to the next day, once they are replaced, so it does not affect the new delegates.
+func (h *wavefrontHistogram) newDelegates() ([]histogram.Histogram, func()) {
+	var completed int32
+	now := func() time.Time {
+		if atomic.LoadInt32(&completed) != 0 {
+			return h.clock().Add(24 * time.Hour)
+		}
+		return h.clock()
+	}
+	delegates := make([]histogram.Histogram, len(h.granularities))
+	for i, g := range h.granularities {
+		// the given options can override this time supplier
+		options := append([]histogram.Option{histogram.TimeSupplier(now)}, h.options...)
+		delegates[i] = histogram.New(append(options, histogram.GranularityOption(g))...)
+	}
+	return delegates, func() { atomic.StoreInt32(&completed, 1) }
 }
 
-// Clear will panic
+func (h Histogram) delegates() []histogram.Histogram {
+	h.h.mux.RLock()
+	defer h.h.mux.RUnlock()
+	return h.h.delegates
+}
+
+func (h Histogram) delegate() histogram.Histogram {
+	return h.delegates()[0]
+}
+
+// Flush completes the current time slices, so their samples are returned by the next
+// call to Distributions instead of waiting for the end of the time slices.
+// The values recorded afterwards in the same time slices are reported in the same distributions
+// if they are not reported yet.
+// It returns ErrCustomTimeSupplier for the histograms created with a histogram.TimeSupplier option,
+// whose time slices only end with their time supplier.
+func (h Histogram) Flush() error {
+	if h.h.customClock {
+		return ErrCustomTimeSupplier
+	}
+
+	h.h.mux.Lock()
+	defer h.h.mux.Unlock()
+
+	// the delegates are replaced before their time slices are completed, so the new values are
+	// recorded in the new delegates, and the readers still using the old ones see their completed time slices
+	delegates, complete := h.h.delegates, h.h.complete
+	h.h.delegates, h.h.complete = h.h.newDelegates()
+	complete()
+	if h.h.pending == nil {
+		h.h.pending = make(map[histogram.Granularity][]histogram.Distribution)
+	}
+	for _, delegate := range delegates {
+		g := delegate.Granularity()
+		h.h.pending[g] = combineDistributions(g, h.h.pending[g], delegate.Distributions())
+	}
+	return nil
+}
+
+// Clear discards all the samples of this histogram.
 func (h Histogram) Clear() {
-	panic("Clear called on a Histogram")
+	h.h.mux.Lock()
+	defer h.h.mux.Unlock()
+	h.h.delegates, h.h.complete = h.h.newDelegates()
+	h.h.pending = nil
+}
+
+// Export returns a copy of the distributions of the completed time slices, which are still reported
+// by this histogram. Flush first to include the current time slices.
+func (h Histogram) Export() *HistogramExport {
+	h.h.mux.RLock()
+	defer h.h.mux.RUnlock()
+
+	res := make(map[histogram.Granularity][]histogram.Distribution)
+	for _, delegate := range h.h.delegates {
+		g := delegate.Granularity()
+		res[g] = combineDistributions(g, delegate.Snapshot(), h.h.pending[g])
+	}
+	return &HistogramExport{Distributions: res}
+}
+
+// Drain flushes the histogram and moves all its distributions to the returned export, so they are
+// not reported by this histogram but by the histogram they are merged in with MergeExport, possibly
+// in another process through the binary or JSON form of the export.
+// It returns ErrCustomTimeSupplier, and leaves the histogram unchanged, for the histograms created
+// with a histogram.TimeSupplier option.
+func (h Histogram) Drain() (*HistogramExport, error) {
+	if err := h.Flush(); err != nil {
+		return nil, err
+	}
+	return &HistogramExport{Distributions: h.DistributionsByGranularity()}, nil
+}
+
+// Merge moves all the distributions of the other histogram to this histogram, like MergeExport(other.Drain()).
+func (h Histogram) Merge(other Histogram) error {
+	e, err := other.Drain()
+	if err != nil {
+		return err
+	}
+	h.MergeExport(e)
+	return nil
+}
+
+// MergeExport merges the exported distributions in the distributions of this histogram, which are
+// reported with them. The distributions of a granularity the export does not have are computed from
+// its finest granularity if it is finer, and are left out otherwise.
+func (h Histogram) MergeExport(e *HistogramExport) {
+	h.h.mux.Lock()
+	defer h.h.mux.Unlock()
+	atomic.AddInt64(&h.h.updates, 1)
+	if h.h.pending == nil {
+		h.h.pending = make(map[histogram.Granularity][]histogram.Distribution)
+	}
+	for _, g := range h.h.granularities {
+		h.h.pending[g] = combineDistributions(g, h.h.pending[g], e.distributionsFor(g))
+	}
+}
+
+// takePending returns the pending distributions of the given granularity, and clears them
+func (h Histogram) takePending(g histogram.Granularity) []histogram.Distribution {
+	h.h.mux.Lock()
+	defer h.h.mux.Unlock()
+	pending := h.h.pending[g]
+	delete(h.h.pending, g)
+	return pending
 }
 
 // Count returns the total number of samples on this histogram.
 func (h Histogram) Count() int64 {
-	return int64(h.delegate.Count())
+	return h.snapshot().Count()
 }
 
-// Min returns the minimum Value of samples on this histogram.
+// Min returns the minimum Value of samples on this histogram, 0 if there is none.
 func (h Histogram) Min() int64 {
-	return int64(h.delegate.Min())
+	return int64(h.MinFloat64())
 }
 
-// Max returns the maximum Value of samples on this histogram.
+// MinFloat64 returns the minimum Value of samples on this histogram, 0 if there is none.
+func (h Histogram) MinFloat64() float64 {
+	return h.snapshot().MinFloat64()
+}
+
+// Max returns the maximum Value of samples on this histogram, 0 if there is none.
 func (h Histogram) Max() int64 {
-	return int64(h.delegate.Max())
+	return int64(h.MaxFloat64())
+}
+
+// MaxFloat64 returns the maximum Value of samples on this histogram, 0 if there is none.
+func (h Histogram) MaxFloat64() float64 {
+	return h.snapshot().MaxFloat64()
 }
 
 // Sum returns the sum of all values on this histogram.
 func (h Histogram) Sum() int64 {
-	return int64(h.delegate.Sum())
+	return int64(h.SumFloat64())
+}
+
+// SumFloat64 returns the sum of all values on this histogram.
+func (h Histogram) SumFloat64() float64 {
+	return h.snapshot().SumFloat64()
 }
 
-// Mean returns the mean values of samples on this histogram.
+// Mean returns the mean values of samples on this histogram, 0 if there is none.
 func (h Histogram) Mean() float64 {
-	return h.delegate.Mean()
+	return h.snapshot().Mean()
 }
 
 // Update registers a new sample in the histogram.
 func (h Histogram) Update(v int64) {
-	h.delegate.Update(float64(v))
+	h.UpdateFloat64(float64(v))
 }
 
-// Sample will panic
+// UpdateFloat64 registers a new sample in the histogram, without truncating it.
+func (h Histogram) UpdateFloat64(v float64) {
+	// held during the update so the value is not recorded while the histogram is flushed
+	h.h.mux.RLock()
+	defer h.h.mux.RUnlock()
+	atomic.AddInt64(&h.h.updates, 1)
+	for _, delegate := range h.h.delegates {
+		delegate.Update(v)
+	}
+}
+
+// updated returns the number of updates and merges of the histogram, to detect idle series
+func (h Histogram) updated() int64 {
+	return atomic.LoadInt64(&h.h.updates)
+}
+
+// UpdateDuration registers a new duration sample in the histogram, in the given unit.
+// For instance UpdateDuration(1500*time.Millisecond, time.Second) registers 1.5.
+func (h Histogram) UpdateDuration(d time.Duration, unit time.Duration) {
+	h.UpdateFloat64(float64(d) / float64(unit))
+}
+
+// UpdateSince registers the duration elapsed since the given time, in nanoseconds like metrics.Timer.
+func (h Histogram) UpdateSince(t time.Time) {
+	h.UpdateDuration(time.Since(t), time.Nanosecond)
+}
+
+// Sample returns a read-only metrics.Sample with the centroids values of this histogram,
+// each value repeated as many times as it has been sampled.
 func (h Histogram) Sample() metrics.Sample {
-	panic("Sample not supported")
+	return h.Snapshot().Sample()
 }
 
-// Snapshot create a metrics.Histogram
+// Snapshot returns a read-only copy of the centroids of the completed time slices,
+// including the flushed and merged distributions
 func (h Histogram) Snapshot() metrics.Histogram {
-	c := 0
-	for _, distribution := range h.delegate.Snapshot() {
-		for _, centroid := range distribution.Centroids {
-			c += centroid.Count
-		}
-	}
+	return h.snapshot()
+}
 
-	sample := metrics.NewUniformSample(c)
-	for _, distribution := range h.delegate.Snapshot() {
-		for _, centroid := range distribution.Centroids {
-			for i := 0; i < centroid.Count; i++ {
-				sample.Update(int64(centroid.Value))
-			}
-		}
-	}
-	return metrics.NewHistogram(sample)
+// snapshot returns the snapshot the statistics of the histogram are computed from,
+// weighting every centroid with its count
+func (h Histogram) snapshot() HistogramSnapshot {
+	delegate := h.delegate()
+	distributions := delegate.Snapshot()
+	h.h.mux.RLock()
+	defer h.h.mux.RUnlock()
+	return newHistogramSnapshot(append(distributions, h.h.pending[delegate.Granularity()]...))
 }
 
 // StdDev returns the standard deviation.
 func (h Histogram) StdDev() float64 {
-	return h.Snapshot().StdDev()
+	return h.snapshot().StdDev()
 }
 
 // Variance returns the variance of inputs.
 func (h Histogram) Variance() float64 {
-	return h.Snapshot().Variance()
+	return h.snapshot().Variance()
 }
 
 // Percentile returns the desired percentile estimation.
 func (h Histogram) Percentile(p float64) float64 {
-	return h.delegate.Quantile(p)
+	return h.snapshot().Percentile(p)
 }
 
 // Percentiles returns a slice of arbitrary percentiles of values in the sample
 func (h Histogram) Percentiles(ps []float64) []float64 {
-	var res []float64
-	for _, p := range ps {
-		res = append(res, h.Percentile(p))
+	return h.snapshot().Percentiles(ps)
+}
+
+// Distributions returns all samples on completed time slices of the finest granularity, and clear them
+func (h Histogram) Distributions() []histogram.Distribution {
+	return h.distributions(h.delegate())
+}
+
+// DistributionsByGranularity returns all samples on completed time slices of every granularity, and clear them
+func (h Histogram) DistributionsByGranularity() map[histogram.Granularity][]histogram.Distribution {
+	res := make(map[histogram.Granularity][]histogram.Distribution)
+	for _, delegate := range h.delegates() {
+		res[delegate.Granularity()] = h.distributions(delegate)
 	}
 	return res
 }
 
-// Distributions returns all samples on completed time slices, and clear the histogram
-func (h Histogram) Distributions() []histogram.Distribution {
-	return h.delegate.Distributions()
+// distributions returns the distributions of the delegate with the pending ones of its granularity,
+// one per time slice, and clear them
+func (h Histogram) distributions(delegate histogram.Histogram) []histogram.Distribution {
+	distributions := delegate.Distributions()
+	return combineDistributions(delegate.Granularity(), distributions, h.takePending(delegate.Granularity()))
 }
 
-// Granularity value
+// Granularity value, the finest one if the histogram has several granularities
 func (h Histogram) Granularity() histogram.Granularity {
-	return h.delegate.Granularity()
+	return h.delegate().Granularity()
+}
+
+// Granularities returns all the granularities of the histogram, the finest first
+func (h Histogram) Granularities() []histogram.Granularity {
+	return h.h.granularities
 }
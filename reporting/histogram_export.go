@@ -0,0 +1,197 @@
+package reporting
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/wavefronthq/wavefront-sdk-go/histogram"
+)
+
+// exportVersion is the first byte of the binary form of a HistogramExport
+const exportVersion = 1
+
+// HistogramExport holds the distributions exported or drained from a Histogram, by granularity, to be merged
+// in another Histogram, possibly in another process through its binary or JSON form.
+type HistogramExport struct {
+	Distributions map[histogram.Granularity][]histogram.Distribution
+}
+
+var granularityNames = map[histogram.Granularity]string{
+	histogram.MINUTE: "minute",
+	histogram.HOUR:   "hour",
+	histogram.DAY:    "day",
+}
+
+type jsonDistribution struct {
+	Granularity string         `json:"granularity"`
+	Timestamp   int64          `json:"timestamp"`
+	Centroids   []jsonCentroid `json:"centroids"`
+}
+
+type jsonCentroid struct {
+	Value float64 `json:"value"`
+	Count int     `json:"count"`
+}
+
+// granularities returns the granularities of the export, the finest first
+func (e *HistogramExport) granularities() []histogram.Granularity {
+	var gs []histogram.Granularity
+	for g := range e.Distributions {
+		gs = append(gs, g)
+	}
+	sort.Slice(gs, func(i, j int) bool { return gs[i] < gs[j] })
+	return gs
+}
+
+// MarshalJSON returns the JSON form of the export, a list of distributions
+// with their granularity, their timestamp in seconds and their centroids.
+func (e HistogramExport) MarshalJSON() ([]byte, error) {
+	distributions := []jsonDistribution{}
+	for _, g := range e.granularities() {
+		for _, distribution := range e.Distributions[g] {
+			d := jsonDistribution{Granularity: granularityNames[g], Timestamp: distribution.Timestamp.Unix()}
+			for _, c := range distribution.Centroids {
+				d.Centroids = append(d.Centroids, jsonCentroid{Value: c.Value, Count: c.Count})
+			}
+			distributions = append(distributions, d)
+		}
+	}
+	return json.Marshal(distributions)
+}
+
+// UnmarshalJSON sets the export from its JSON form.
+func (e *HistogramExport) UnmarshalJSON(data []byte) error {
+	var distributions []jsonDistribution
+	if err := json.Unmarshal(data, &distributions); err != nil {
+		return err
+	}
+	e.Distributions = make(map[histogram.Granularity][]histogram.Distribution)
+	for _, d := range distributions {
+		g, ok := granularityOf(d.Granularity)
+		if !ok {
+			return fmt.Errorf("unknown histogram granularity %q", d.Granularity)
+		}
+		distribution := histogram.Distribution{Timestamp: time.Unix(d.Timestamp, 0)}
+		for _, c := range d.Centroids {
+			distribution.Centroids = append(distribution.Centroids, histogram.Centroid{Value: c.Value, Count: c.Count})
+		}
+		e.Distributions[g] = append(e.Distributions[g], distribution)
+	}
+	return nil
+}
+
+func granularityOf(name string) (histogram.Granularity, bool) {
+	for g, n := range granularityNames {
+		if n == name {
+			return g, true
+		}
+	}
+	return 0, false
+}
+
+// MarshalBinary returns the compact binary form of the export: a version byte, then every distribution
+// as its granularity byte, its varint timestamp in seconds, its uvarint number of centroids and
+// for every centroid its float64 value in little endian and its uvarint count.
+func (e HistogramExport) MarshalBinary() ([]byte, error) {
+	data := []byte{exportVersion}
+	buf := make([]byte, binary.MaxVarintLen64)
+	for _, g := range e.granularities() {
+		for _, distribution := range e.Distributions[g] {
+			data = append(data, byte(g))
+			data = append(data, buf[:binary.PutVarint(buf, distribution.Timestamp.Unix())]...)
+			data = append(data, buf[:binary.PutUvarint(buf, uint64(len(distribution.Centroids)))]...)
+			for _, c := range distribution.Centroids {
+				binary.LittleEndian.PutUint64(buf, math.Float64bits(c.Value))
+				data = append(data, buf[:8]...)
+				data = append(data, buf[:binary.PutUvarint(buf, uint64(c.Count))]...)
+			}
+		}
+	}
+	return data, nil
+}
+
+// UnmarshalBinary sets the export from its binary form.
+func (e *HistogramExport) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || data[0] != exportVersion {
+		return fmt.Errorf("unsupported histogram export version")
+	}
+	data = data[1:]
+	invalid := fmt.Errorf("truncated histogram export")
+
+	distributions := make(map[histogram.Granularity][]histogram.Distribution)
+	for len(data) > 0 {
+		g := histogram.Granularity(data[0])
+		if _, ok := granularityNames[g]; !ok {
+			return fmt.Errorf("unknown histogram granularity %d", g)
+		}
+		ts, n := binary.Varint(data[1:])
+		if n <= 0 {
+			return invalid
+		}
+		data = data[1+n:]
+		count, n := binary.Uvarint(data)
+		if n <= 0 || count > uint64(len(data)) {
+			return invalid
+		}
+		data = data[n:]
+
+		distribution := histogram.Distribution{Timestamp: time.Unix(ts, 0), Centroids: make([]histogram.Centroid, count)}
+		for i := range distribution.Centroids {
+			if len(data) < 8 {
+				return invalid
+			}
+			value := math.Float64frombits(binary.LittleEndian.Uint64(data))
+			c, n := binary.Uvarint(data[8:])
+			if n <= 0 {
+				return invalid
+			}
+			data = data[8+n:]
+			distribution.Centroids[i] = histogram.Centroid{Value: value, Count: int(c)}
+		}
+		distributions[g] = append(distributions[g], distribution)
+	}
+	e.Distributions = distributions
+	return nil
+}
+
+// distributionsFor returns the distributions of the export for the given granularity, or the distributions
+// of its finest granularity in time slices of the given granularity if it is finer, or none as the time slices
+// of a coarser granularity cannot be split
+func (e *HistogramExport) distributionsFor(g histogram.Granularity) []histogram.Distribution {
+	if distributions, ok := e.Distributions[g]; ok {
+		return distributions
+	}
+	gs := e.granularities()
+	if len(gs) == 0 || gs[0] > g {
+		return nil
+	}
+	return combineDistributions(g, e.Distributions[gs[0]])
+}
+
+// combineDistributions merges the given distributions by time slice of the given granularity
+func combineDistributions(g histogram.Granularity, distributions ...[]histogram.Distribution) []histogram.Distribution {
+	slices := make(map[int64]histogram.Centroids)
+	timestamps := make(map[int64]time.Time)
+	for _, ds := range distributions {
+		for _, d := range ds {
+			if len(d.Centroids) == 0 {
+				continue
+			}
+			ts := d.Timestamp.Truncate(g.Duration())
+			slices[ts.Unix()] = append(slices[ts.Unix()], d.Centroids...)
+			timestamps[ts.Unix()] = ts
+		}
+	}
+	res := make([]histogram.Distribution, 0, len(slices))
+	for ts, centroids := range slices {
+		centroids = centroids.Compact()
+		sort.Slice(centroids, func(i, j int) bool { return centroids[i].Value < centroids[j].Value })
+		res = append(res, histogram.Distribution{Timestamp: timestamps[ts], Centroids: centroids})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Timestamp.Before(res[j].Timestamp) })
+	return res
+}
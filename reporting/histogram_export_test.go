@@ -0,0 +1,142 @@
+package reporting
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/wavefronthq/wavefront-sdk-go/histogram"
+)
+
+func TestHistogramExportForms(t *testing.T) {
+	clock := &testClock{now: time.Date(2020, 1, 1, 10, 30, 0, 0, time.UTC)}
+	h := newHistogram(clock.Now, histogram.GranularityOption(histogram.MINUTE), histogram.GranularityOption(histogram.HOUR))
+	h.UpdateFloat64(1.5)
+	h.Update(10)
+	h.Update(10)
+	export, err := h.Drain()
+	assert.NoError(t, err)
+	assert.Empty(t, h.Distributions())
+	assert.Equal(t, 1, len(export.Distributions[histogram.MINUTE]))
+	assert.Equal(t, 1, len(export.Distributions[histogram.HOUR]))
+
+	data, err := export.MarshalBinary()
+	assert.NoError(t, err)
+	decoded := &HistogramExport{}
+	assert.NoError(t, decoded.UnmarshalBinary(data))
+	assertSameExport(t, export, decoded)
+
+	data, err = json.Marshal(export)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"granularity":"hour"`)
+	decoded = &HistogramExport{}
+	assert.NoError(t, json.Unmarshal(data, decoded))
+	assertSameExport(t, export, decoded)
+
+	data, _ = export.MarshalBinary()
+	assert.Error(t, decoded.UnmarshalBinary(data[:len(data)-3]))
+	assert.Error(t, decoded.UnmarshalBinary([]byte{42}))
+	assert.Error(t, json.Unmarshal([]byte(`[{"granularity":"week"}]`), decoded))
+}
+
+func assertSameExport(t *testing.T, expected, actual *HistogramExport) {
+	assert.Equal(t, len(expected.Distributions), len(actual.Distributions))
+	for g, distributions := range expected.Distributions {
+		if assert.Equal(t, len(distributions), len(actual.Distributions[g])) {
+			for i, d := range distributions {
+				assert.Equal(t, d.Timestamp.Unix(), actual.Distributions[g][i].Timestamp.Unix())
+				assert.Equal(t, d.Centroids, actual.Distributions[g][i].Centroids)
+			}
+		}
+	}
+}
+
+func TestHistogramExportKeepsDistributions(t *testing.T) {
+	clock := &testClock{now: time.Date(2020, 1, 1, 10, 30, 0, 0, time.UTC)}
+	h := newHistogram(clock.Now)
+	h.Update(10)
+	assert.Empty(t, h.Export().Distributions[histogram.MINUTE])
+
+	assert.NoError(t, h.Flush())
+	export := h.Export()
+	assert.Equal(t, export.Distributions[histogram.MINUTE], h.Export().Distributions[histogram.MINUTE])
+	distributions := h.Distributions()
+	if assert.Equal(t, 1, len(distributions)) {
+		assert.Equal(t, distributions, export.Distributions[histogram.MINUTE])
+	}
+
+	custom := NewHistogram(histogram.TimeSupplier(clock.Now)).(Histogram)
+	_, err := custom.Drain()
+	assert.Equal(t, ErrCustomTimeSupplier, err)
+	assert.Equal(t, ErrCustomTimeSupplier, h.Merge(custom))
+}
+
+func TestHistogramMerge(t *testing.T) {
+	clock := &testClock{now: time.Date(2020, 1, 1, 10, 30, 0, 0, time.UTC)}
+	h := newHistogram(clock.Now, histogram.GranularityOption(histogram.MINUTE), histogram.GranularityOption(histogram.HOUR))
+	worker := newHistogram(clock.Now)
+	h.Update(10)
+	worker.Update(10)
+	worker.Update(20)
+
+	assert.NoError(t, h.Merge(worker))
+	assert.Empty(t, worker.Distributions())
+	// the current time slice of h is not completed yet
+	assert.Equal(t, int64(2), h.Snapshot().Count())
+
+	// the minute distributions of the worker are merged in the hour distributions too
+	h.Flush()
+	distributions := h.DistributionsByGranularity()
+	for _, g := range h.Granularities() {
+		if assert.Equal(t, 1, len(distributions[g]), "granularity %v", g) {
+			assert.Equal(t, clock.Now().Truncate(g.Duration()).Unix(), distributions[g][0].Timestamp.Unix())
+			assert.Equal(t, []histogram.Centroid{{Value: 10, Count: 2}, {Value: 20, Count: 1}}, distributions[g][0].Centroids)
+		}
+	}
+	assert.Empty(t, h.Distributions())
+}
+
+func TestHistogramMergeCoarserExport(t *testing.T) {
+	clock := &testClock{now: time.Date(2020, 1, 1, 10, 30, 0, 0, time.UTC)}
+	h := newHistogram(clock.Now, histogram.GranularityOption(histogram.MINUTE), histogram.GranularityOption(histogram.DAY))
+	worker := newHistogram(clock.Now, histogram.GranularityOption(histogram.HOUR))
+	worker.Update(10)
+
+	// the hour distributions are merged in the day distributions only, they cannot be split by minute
+	assert.NoError(t, h.Merge(worker))
+	distributions := h.DistributionsByGranularity()
+	assert.Empty(t, distributions[histogram.MINUTE])
+	if assert.Equal(t, 1, len(distributions[histogram.DAY])) {
+		assert.Equal(t, clock.Now().Truncate(24*time.Hour).Unix(), distributions[histogram.DAY][0].Timestamp.Unix())
+		assert.Equal(t, []histogram.Centroid{{Value: 10, Count: 1}}, distributions[histogram.DAY][0].Centroids)
+	}
+}
+
+func TestReportMergedHistogram(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(), CustomRegistry(metrics.NewRegistry()))
+
+	clock := &testClock{now: time.Now()}
+	h := newHistogram(clock.Now)
+	reporter.RegisterMetric("h", h, nil)
+
+	worker := newHistogram(clock.Now)
+	worker.Update(5)
+	drained, err := worker.Drain()
+	assert.NoError(t, err)
+	data, _ := drained.MarshalBinary()
+	export := &HistogramExport{}
+	assert.NoError(t, export.UnmarshalBinary(data))
+	h.MergeExport(export)
+
+	reporter.Report()
+	if assert.Equal(t, 1, len(sender.Distributions)) {
+		assert.Equal(t, []histogram.Centroid{{Value: 5, Count: 1}}, sender.Distributions[0].Centroids)
+	}
+	reporter.Report()
+	assert.Equal(t, 1, len(sender.Distributions))
+
+	reporter.Close()
+}
@@ -0,0 +1,190 @@
+package reporting
+
+import (
+	"math"
+	"sort"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/wavefronthq/wavefront-sdk-go/histogram"
+)
+
+// HistogramSnapshot is a read-only copy of the centroids of a Histogram.
+// Its statistics are computed from the centroids means and weights, as if every
+// centroid value had been sampled as many times as the centroid count.
+type HistogramSnapshot struct {
+	centroids []histogram.Centroid // sorted by value
+	count     int64
+	sum       float64
+}
+
+func newHistogramSnapshot(distributions []histogram.Distribution) HistogramSnapshot {
+	s := HistogramSnapshot{}
+	for _, distribution := range distributions {
+		for _, centroid := range distribution.Centroids {
+			s.centroids = append(s.centroids, centroid)
+			s.count += int64(centroid.Count)
+			s.sum += centroid.Value * float64(centroid.Count)
+		}
+	}
+	sort.Slice(s.centroids, func(i, j int) bool {
+		return s.centroids[i].Value < s.centroids[j].Value
+	})
+	return s
+}
+
+// Clear panics.
+func (HistogramSnapshot) Clear() {
+	panic("Clear called on a HistogramSnapshot")
+}
+
+// Count returns the number of samples at the time the snapshot was taken.
+func (s HistogramSnapshot) Count() int64 {
+	return s.count
+}
+
+// Max returns the maximum value at the time the snapshot was taken.
+func (s HistogramSnapshot) Max() int64 {
+	return int64(s.MaxFloat64())
+}
+
+// MaxFloat64 returns the maximum value at the time the snapshot was taken.
+func (s HistogramSnapshot) MaxFloat64() float64 {
+	if len(s.centroids) == 0 {
+		return 0
+	}
+	return s.centroids[len(s.centroids)-1].Value
+}
+
+// Mean returns the mean value at the time the snapshot was taken.
+func (s HistogramSnapshot) Mean() float64 {
+	if s.count == 0 {
+		return 0
+	}
+	return s.sum / float64(s.count)
+}
+
+// Min returns the minimum value at the time the snapshot was taken.
+func (s HistogramSnapshot) Min() int64 {
+	return int64(s.MinFloat64())
+}
+
+// MinFloat64 returns the minimum value at the time the snapshot was taken.
+func (s HistogramSnapshot) MinFloat64() float64 {
+	if len(s.centroids) == 0 {
+		return 0
+	}
+	return s.centroids[0].Value
+}
+
+// Percentile returns an arbitrary percentile of the values at the time the snapshot was taken.
+func (s HistogramSnapshot) Percentile(p float64) float64 {
+	return s.Percentiles([]float64{p})[0]
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the values at the time the snapshot
+// was taken, interpolated like the go-metrics samples percentiles.
+func (s HistogramSnapshot) Percentiles(ps []float64) []float64 {
+	scores := make([]float64, len(ps))
+	if s.count == 0 {
+		return scores
+	}
+	for i, p := range ps {
+		pos := p * float64(s.count+1)
+		if pos < 1.0 {
+			scores[i] = s.centroids[0].Value
+		} else if pos >= float64(s.count) {
+			scores[i] = s.centroids[len(s.centroids)-1].Value
+		} else {
+			lower := s.valueAt(int64(pos) - 1)
+			upper := s.valueAt(int64(pos))
+			scores[i] = lower + (pos-math.Floor(pos))*(upper-lower)
+		}
+	}
+	return scores
+}
+
+// valueAt returns the value of the given 0 based rank
+func (s HistogramSnapshot) valueAt(rank int64) float64 {
+	for _, centroid := range s.centroids {
+		if rank < int64(centroid.Count) {
+			return centroid.Value
+		}
+		rank -= int64(centroid.Count)
+	}
+	return s.centroids[len(s.centroids)-1].Value
+}
+
+// Sample returns a read-only metrics.Sample over the centroids, whose statistics are the snapshot ones.
+func (s HistogramSnapshot) Sample() metrics.Sample {
+	return histogramSample{s}
+}
+
+// Snapshot returns the snapshot.
+func (s HistogramSnapshot) Snapshot() metrics.Histogram {
+	return s
+}
+
+// StdDev returns the standard deviation of the values at the time the snapshot was taken.
+func (s HistogramSnapshot) StdDev() float64 {
+	return math.Sqrt(s.Variance())
+}
+
+// Sum returns the sum of the values at the time the snapshot was taken.
+func (s HistogramSnapshot) Sum() int64 {
+	return int64(s.sum)
+}
+
+// SumFloat64 returns the sum of the values at the time the snapshot was taken.
+func (s HistogramSnapshot) SumFloat64() float64 {
+	return s.sum
+}
+
+// Update panics.
+func (HistogramSnapshot) Update(int64) {
+	panic("Update called on a HistogramSnapshot")
+}
+
+// Variance returns the variance of the values at the time the snapshot was taken.
+func (s HistogramSnapshot) Variance() float64 {
+	if s.count == 0 {
+		return 0
+	}
+	m := s.Mean()
+	var sum float64
+	for _, centroid := range s.centroids {
+		d := centroid.Value - m
+		sum += d * d * float64(centroid.Count)
+	}
+	return sum / float64(s.count)
+}
+
+// histogramSample is the metrics.Sample of a HistogramSnapshot, only its values are expanded from the centroids
+type histogramSample struct {
+	s HistogramSnapshot
+}
+
+func (histogramSample) Clear()                               { panic("Clear called on a HistogramSnapshot sample") }
+func (h histogramSample) Count() int64                       { return h.s.Count() }
+func (h histogramSample) Max() int64                         { return h.s.Max() }
+func (h histogramSample) Mean() float64                      { return h.s.Mean() }
+func (h histogramSample) Min() int64                         { return h.s.Min() }
+func (h histogramSample) Percentile(p float64) float64       { return h.s.Percentile(p) }
+func (h histogramSample) Percentiles(ps []float64) []float64 { return h.s.Percentiles(ps) }
+func (h histogramSample) Size() int                          { return int(h.s.Count()) }
+func (h histogramSample) Snapshot() metrics.Sample           { return h }
+func (h histogramSample) StdDev() float64                    { return h.s.StdDev() }
+func (h histogramSample) Sum() int64                         { return h.s.Sum() }
+func (histogramSample) Update(int64)                         { panic("Update called on a HistogramSnapshot sample") }
+func (h histogramSample) Variance() float64                  { return h.s.Variance() }
+
+// Values returns the value of every centroid, truncated, repeated as many times as the centroid count.
+// The other methods are computed from the centroids without expanding them.
+func (h histogramSample) Values() []int64 {
+	values := make([]int64, 0, h.s.count)
+	for _, centroid := range h.s.centroids {
+		for i := 0; i < centroid.Count; i++ {
+			values = append(values, int64(centroid.Value))
+		}
+	}
+	return values
+}
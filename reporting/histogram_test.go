@@ -1,7 +1,9 @@
 package reporting
 
 import (
+	"bytes"
 	"math"
+	"math/rand"
 	"testing"
 	"time"
 
@@ -40,15 +42,15 @@ func TestHistogramCal(t *testing.T) {
 	//Max
 	assert.Equal(t, int64(100000), pow10.Max())
 	assert.Equal(t, int64(100000), pow10.Snapshot().Max())
-	assert.Equal(t, int64(math.NaN()), emptyHistogram.Max())
+	assert.Equal(t, int64(0), emptyHistogram.Max())
 	//Min
 	assert.Equal(t, int64(1), inc100.Min())
 	assert.Equal(t, int64(1), inc100.Snapshot().Min())
-	assert.Equal(t, int64(math.NaN()), emptyHistogram.Min())
+	assert.Equal(t, int64(0), emptyHistogram.Min())
 	//Mean
 	assert.Equal(t, float64(13457.888888888889), pow10.Mean())
 	assert.Equal(t, float64(13457.888888888889), pow10.Snapshot().Mean())
-	assert.True(t, math.IsNaN(emptyHistogram.Mean()))
+	assert.Equal(t, float64(0), emptyHistogram.Mean())
 	//Sum
 	assert.Equal(t, int64(121121), pow10.Sum())
 	assert.Equal(t, int64(121121), pow10.Snapshot().Sum())
@@ -83,3 +85,362 @@ func TestWFHistogramAPI(t *testing.T) {
 		t.Fatalf("the histogram is not 'histogram.Histogram'")
 	}
 }
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (c *testClock) Add(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestWFHistogramInterface(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+	h := NewHistogram(histogram.TimeSupplier(clock.Now))
+	for _, v := range []int64{1, 2, 2, 3, 4} {
+		h.Update(v)
+	}
+	clock.Add(time.Minute)
+
+	assert.Equal(t, int64(1), h.Min())
+	assert.Equal(t, int64(4), h.Max())
+	assert.Equal(t, int64(12), h.Sum())
+	assert.Equal(t, 2.4, h.Mean())
+	assert.Equal(t, []float64{h.Percentile(0.5), h.Percentile(0.9)}, h.Percentiles([]float64{0.5, 0.9}))
+	assert.InDelta(t, 1.04, h.Variance(), 1e-9)
+	assert.InDelta(t, math.Sqrt(1.04), h.StdDev(), 1e-9)
+	assert.Equal(t, int64(5), h.Count())
+
+	sample := h.Sample()
+	assert.Equal(t, int64(5), sample.Count())
+	assert.Equal(t, 5, sample.Size())
+	assert.Equal(t, []int64{1, 2, 2, 3, 4}, sample.Values())
+	assert.Equal(t, int64(12), sample.Sum())
+	assert.Equal(t, h.Percentiles([]float64{0.5, 0.9}), sample.Percentiles([]float64{0.5, 0.9}))
+	assert.Equal(t, sample, sample.Snapshot())
+	assert.Panics(t, func() { sample.Update(1) })
+	assert.Panics(t, func() { sample.Clear() })
+
+	snapshot := h.Snapshot()
+	assert.Equal(t, int64(5), snapshot.Count())
+	assert.Equal(t, int64(4), snapshot.Max())
+	assert.Equal(t, 2.0, snapshot.Percentile(0.5))
+
+	h.Clear()
+	assert.Equal(t, int64(0), h.Count())
+	assert.Equal(t, int64(0), h.Sample().Count())
+	assert.Empty(t, h.(Histogram).Distributions())
+
+	h.Update(10)
+	clock.Add(time.Minute)
+	assert.Equal(t, int64(10), h.Max())
+	assert.Equal(t, 1, len(h.(Histogram).Distributions()))
+}
+
+func TestWFHistogramWeightedStatistics(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+	h := NewHistogram(histogram.TimeSupplier(clock.Now))
+	for i := 0; i < 1990; i++ {
+		h.Update(1)
+	}
+	for i := 0; i < 10; i++ {
+		h.Update(1000)
+	}
+	assert.Equal(t, int64(0), h.Count())
+	assert.Equal(t, int64(0), h.Min())
+	clock.Add(time.Minute)
+
+	// the statistics weight every centroid with its count, like the snapshot
+	assert.Equal(t, int64(2000), h.Count())
+	assert.Equal(t, int64(1), h.Min())
+	assert.Equal(t, int64(1000), h.Max())
+	assert.Equal(t, 5.995, h.Mean())
+	assert.Equal(t, []float64{1, 1}, h.Percentiles([]float64{0.5, 0.99}))
+	assert.Equal(t, h.Snapshot().Percentiles([]float64{0.5, 0.999}), h.Percentiles([]float64{0.5, 0.999}))
+}
+
+func TestWFHistogramGenericCode(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+	registry := metrics.NewRegistry()
+	h := NewHistogram(histogram.TimeSupplier(clock.Now))
+	registry.Register("wf.histogram", h)
+	for i := int64(1); i <= 100; i++ {
+		h.Update(i)
+	}
+	clock.Add(time.Minute)
+
+	var buf bytes.Buffer
+	assert.NotPanics(t, func() {
+		metrics.WriteOnce(registry, &buf)
+		metrics.WriteJSONOnce(registry, &buf)
+	})
+	assert.Contains(t, buf.String(), "histogram wf.histogram")
+}
+
+func TestWFHistogramSnapshot(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+	h := NewHistogram(histogram.TimeSupplier(clock.Now))
+	for _, v := range []int64{5, 1, 3} {
+		h.Update(v)
+	}
+	clock.Add(time.Minute)
+	h.Update(100) // current time slice, not in the snapshot
+
+	snapshot := h.Snapshot()
+	assert.IsType(t, HistogramSnapshot{}, snapshot)
+	assert.Equal(t, snapshot, snapshot.Snapshot())
+	assert.Equal(t, int64(3), snapshot.Count())
+	assert.Equal(t, int64(1), snapshot.Min())
+	assert.Equal(t, int64(5), snapshot.Max())
+	assert.Equal(t, int64(9), snapshot.Sum())
+	assert.Equal(t, float64(3), snapshot.Mean())
+	assert.InDelta(t, 8.0/3, snapshot.Variance(), 1e-9)
+	assert.Equal(t, []float64{1, 3, 5}, snapshot.Percentiles([]float64{0.1, 0.5, 0.99}))
+	assert.Panics(t, func() { snapshot.Update(1) })
+	assert.Panics(t, func() { snapshot.Clear() })
+
+	expanded := expandedSnapshot(h.(Histogram))
+	assert.Equal(t, expanded.Percentiles([]float64{0.25, 0.5, 0.75}), snapshot.Percentiles([]float64{0.25, 0.5, 0.75}))
+	assert.Equal(t, expanded.StdDev(), snapshot.StdDev())
+
+	empty := NewHistogram().Snapshot()
+	assert.Equal(t, int64(0), empty.Count())
+	assert.Equal(t, int64(0), empty.Max())
+	assert.Equal(t, float64(0), empty.Mean())
+	assert.Equal(t, float64(0), empty.StdDev())
+	assert.Equal(t, []float64{0}, empty.Percentiles([]float64{0.5}))
+}
+
+// expandedSnapshot is the snapshot implementation expanding every centroid into individual values
+func expandedSnapshot(h Histogram) metrics.Histogram {
+	c := 0
+	for _, distribution := range h.delegate().Snapshot() {
+		for _, centroid := range distribution.Centroids {
+			c += centroid.Count
+		}
+	}
+
+	sample := metrics.NewUniformSample(c)
+	for _, distribution := range h.delegate().Snapshot() {
+		for _, centroid := range distribution.Centroids {
+			for i := 0; i < centroid.Count; i++ {
+				sample.Update(int64(centroid.Value))
+			}
+		}
+	}
+	return metrics.NewHistogram(sample)
+}
+
+func benchmarkHistogram(b *testing.B) Histogram {
+	clock := &testClock{now: time.Now()}
+	h := NewHistogram(histogram.TimeSupplier(clock.Now))
+	for i := 0; i < 100000; i++ {
+		h.Update(rand.Int63n(1000000))
+	}
+	clock.Add(time.Minute)
+	b.ResetTimer()
+	return h.(Histogram)
+}
+
+func BenchmarkHistogramSnapshot(b *testing.B) {
+	h := benchmarkHistogram(b)
+	for i := 0; i < b.N; i++ {
+		h.Snapshot().StdDev()
+	}
+}
+
+func BenchmarkHistogramSnapshotExpanded(b *testing.B) {
+	h := benchmarkHistogram(b)
+	for i := 0; i < b.N; i++ {
+		expandedSnapshot(h).StdDev()
+	}
+}
+
+func TestWFHistogramFloat64(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+	h := NewHistogram(histogram.TimeSupplier(clock.Now)).(Histogram)
+	h.UpdateFloat64(0.25)
+	h.UpdateDuration(1500*time.Millisecond, time.Second)
+	h.UpdateSince(time.Now().Add(-time.Millisecond))
+	clock.Add(time.Minute)
+
+	assert.Equal(t, 0.25, h.MinFloat64())
+	assert.Equal(t, int64(0), h.Min())
+	assert.True(t, h.MaxFloat64() >= float64(time.Millisecond))
+	assert.InDelta(t, 1.75+h.MaxFloat64(), h.SumFloat64(), 1e-6)
+
+	snapshot := h.Snapshot().(HistogramSnapshot)
+	assert.Equal(t, 0.25, snapshot.MinFloat64())
+	assert.Equal(t, h.MaxFloat64(), snapshot.MaxFloat64())
+	assert.InDelta(t, h.SumFloat64(), snapshot.SumFloat64(), 1e-6)
+	assert.Equal(t, 1.5, snapshot.Percentile(0.5))
+
+	var _ metrics.Histogram = h
+}
+
+func TestWFHistogramSampleFractions(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+	h := NewHistogram(histogram.TimeSupplier(clock.Now)).(Histogram)
+	h.UpdateFloat64(0.25)
+	h.UpdateFloat64(0.75)
+	clock.Add(time.Minute)
+
+	// the statistics of the sample are not computed from the truncated values
+	sample := h.Sample()
+	assert.Equal(t, 0.5, sample.Mean())
+	assert.Equal(t, 0.75, sample.Percentile(0.99))
+	assert.Equal(t, []int64{0, 0}, sample.Values())
+}
+
+func TestWFHistogramGranularities(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+	h := NewHistogram(histogram.GranularityOption(histogram.HOUR), histogram.TimeSupplier(clock.Now),
+		histogram.GranularityOption(histogram.MINUTE)).(Histogram)
+	assert.Equal(t, []histogram.Granularity{histogram.MINUTE, histogram.HOUR}, h.Granularities())
+	assert.Equal(t, histogram.MINUTE, h.Granularity())
+
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(), CustomRegistry(metrics.NewRegistry()))
+	reporter.RegisterMetric("h", h, nil)
+
+	h.Update(10)
+	h.Update(20)
+	clock.Add(time.Minute)
+	reporter.Report()
+	if assert.Equal(t, 1, len(sender.Distributions)) {
+		assert.Equal(t, map[histogram.Granularity]bool{histogram.MINUTE: true}, sender.Distributions[0].Granularities)
+	}
+
+	clock.Add(time.Hour)
+	reporter.Report()
+	if assert.Equal(t, 2, len(sender.Distributions)) {
+		assert.Equal(t, map[histogram.Granularity]bool{histogram.HOUR: true}, sender.Distributions[1].Granularities)
+		assert.Equal(t, []histogram.Centroid{{Value: 10, Count: 1}, {Value: 20, Count: 1}}, sender.Distributions[1].Centroids)
+	}
+
+	reporter.Close()
+}
+
+func TestWFHistogramFlush(t *testing.T) {
+	clock := &testClock{now: time.Date(2020, 1, 1, 10, 30, 0, 0, time.UTC)}
+	h := newHistogram(clock.Now, histogram.GranularityOption(histogram.MINUTE), histogram.GranularityOption(histogram.HOUR))
+	h.Update(10)
+	assert.Empty(t, h.Distributions())
+
+	h.Flush()
+	distributions := h.DistributionsByGranularity()
+	for _, g := range h.Granularities() {
+		if assert.Equal(t, 1, len(distributions[g])) {
+			assert.Equal(t, clock.Now().Truncate(g.Duration()), distributions[g][0].Timestamp)
+			assert.Equal(t, []histogram.Centroid{{Value: 10, Count: 1}}, distributions[g][0].Centroids)
+		}
+	}
+
+	// the values recorded after the flush go to a new time slice
+	h.Update(20)
+	clock.Add(time.Minute)
+	distributions = h.DistributionsByGranularity()
+	assert.Equal(t, 20.0, distributions[histogram.MINUTE][len(distributions[histogram.MINUTE])-1].Centroids[0].Value)
+}
+
+func TestWFHistogramRepeatedFlushes(t *testing.T) {
+	clock := &testClock{now: time.Date(2020, 1, 1, 10, 30, 0, 0, time.UTC)}
+	h := newHistogram(clock.Now)
+	for _, v := range []float64{1, 2, 3} {
+		h.UpdateFloat64(v)
+		assert.NoError(t, h.Flush())
+	}
+	assert.Equal(t, int64(3), h.Count())
+	assert.Equal(t, 3.0, h.MaxFloat64())
+
+	distributions := h.Distributions()
+	if assert.Equal(t, 1, len(distributions)) {
+		assert.Equal(t, clock.Now(), distributions[0].Timestamp)
+		assert.Equal(t, []histogram.Centroid{{Value: 1, Count: 1}, {Value: 2, Count: 1}, {Value: 3, Count: 1}}, distributions[0].Centroids)
+	}
+
+	// no time slice is left behind by the flushes
+	clock.Add(time.Minute)
+	assert.Empty(t, h.Distributions())
+}
+
+func TestWFHistogramFlushTimeSupplier(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+	h := NewHistogram(histogram.TimeSupplier(clock.Now)).(Histogram)
+	h.Update(1)
+	assert.Equal(t, ErrCustomTimeSupplier, h.Flush())
+	assert.Empty(t, h.Distributions())
+
+	clock.Add(time.Minute)
+	assert.Equal(t, 1, len(h.Distributions()))
+}
+
+func TestFlushOnClose(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(), CustomRegistry(metrics.NewRegistry()))
+
+	clock := &testClock{now: time.Now()}
+	h := newHistogram(clock.Now)
+	reporter.RegisterMetric("h", h, nil)
+	h.Update(10)
+	reporter.Report()
+	assert.Empty(t, sender.Distributions)
+
+	reporter.Close()
+	assert.Eventually(t, sender.isClosed, time.Second, time.Millisecond)
+	if assert.Equal(t, 1, len(sender.Distributions)) {
+		assert.Equal(t, []histogram.Centroid{{Value: 10, Count: 1}}, sender.Distributions[0].Centroids)
+	}
+
+	// the reports after the close do not block, and send nothing
+	h.Update(20)
+	reported := make(chan bool)
+	go func() {
+		reporter.Report()
+		reported <- true
+	}()
+	select {
+	case <-reported:
+	case <-time.After(time.Second):
+		t.Fatal("report after close blocked")
+	}
+	assert.Equal(t, 1, len(sender.Distributions))
+}
+
+func TestWFHistogramConcurrentFlushes(t *testing.T) {
+	clock := &testClock{now: time.Date(2020, 1, 1, 10, 30, 0, 0, time.UTC)}
+	h := newHistogram(clock.Now)
+
+	done := make(chan bool)
+	for i := 0; i < 4; i++ {
+		go func() {
+			for j := 0; j < 250; j++ {
+				h.Update(int64(j))
+				h.Percentile(0.5)
+				h.Snapshot()
+			}
+			done <- true
+		}()
+	}
+	var count int
+	for running := 4; running > 0; {
+		select {
+		case <-done:
+			running--
+		default:
+			assert.NoError(t, h.Flush())
+		}
+	}
+	assert.NoError(t, h.Flush())
+	for _, distribution := range h.Distributions() {
+		for _, centroid := range distribution.Centroids {
+			count += centroid.Count
+		}
+	}
+	// no value is lost or counted twice by the flushes
+	assert.Equal(t, 1000, count)
+}
@@ -0,0 +1,22 @@
+package reporting
+
+// internalPrefix is the prefix of the metrics the reporter emits about itself
+const internalPrefix = "~go-metrics-wavefront."
+
+// reportInternalMetrics sends the reporter self-metrics
+func (r *reporter) reportInternalMetrics() {
+	for name, count := range r.cardinality.overflows() {
+		tags := r.addApplicationTags(map[string]string{"metric": name})
+		r.errors <- r.sender.SendMetric(internalPrefix+"cardinality.overflow.count", float64(count), 0, r.source, tags)
+	}
+	r.seriesMux.Lock()
+	dropped := r.deltaDropped
+	r.seriesMux.Unlock()
+	if dropped > 0 {
+		tags := r.addApplicationTags(map[string]string{})
+		r.errors <- r.sender.SendMetric(internalPrefix+"delta.dropped.count", dropped, 0, r.source, tags)
+	}
+	if r.cardinalityMetrics {
+		r.reportCardinality()
+	}
+}
@@ -0,0 +1,176 @@
+package reporting
+
+import (
+	"sort"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// MetricType is the kind of a registered metric
+type MetricType string
+
+// Metric types of the registered metrics
+const (
+	TypeCounter            MetricType = "counter"
+	TypeCounterFloat64     MetricType = "counter-float64"
+	TypeGauge              MetricType = "gauge"
+	TypeGaugeFloat64       MetricType = "gauge-float64"
+	TypeWavefrontHistogram MetricType = "wavefront-histogram"
+	TypeWindowedHistogram  MetricType = "windowed-histogram"
+	TypeHistogram          MetricType = "histogram"
+	TypeMeter              MetricType = "meter"
+	TypeWavefrontTimer     MetricType = "wavefront-timer"
+	TypeWindowedTimer      MetricType = "windowed-timer"
+	TypeTimer              MetricType = "timer"
+	TypeBucketHistogram    MetricType = "bucket-histogram"
+	TypeTopK               MetricType = "top-k"
+	TypeUnknown            MetricType = "unknown"
+)
+
+// TypeOf returns the type of the given metric
+func TypeOf(metric interface{}) MetricType {
+	switch metric.(type) {
+	case metrics.Counter:
+		return TypeCounter
+	case CounterFloat64:
+		return TypeCounterFloat64
+	case metrics.Gauge:
+		return TypeGauge
+	case metrics.GaugeFloat64:
+		return TypeGaugeFloat64
+	case Histogram:
+		return TypeWavefrontHistogram
+	case WindowedHistogram:
+		return TypeWindowedHistogram
+	case metrics.Histogram:
+		return TypeHistogram
+	case metrics.Meter:
+		return TypeMeter
+	case Timer:
+		return TypeWavefrontTimer
+	case WindowedTimer:
+		return TypeWindowedTimer
+	case metrics.Timer:
+		return TypeTimer
+	case *BucketHistogram:
+		return TypeBucketHistogram
+	case *TopK:
+		return TypeTopK
+	}
+	return TypeUnknown
+}
+
+// Selector selects registered series by metric name and tag values
+type Selector struct {
+	Name        string            // shell pattern (see path.Match) matching the metric name, empty matches any name
+	Tags        map[string]string // exact tag values, the series must have all these tags
+	TagPatterns map[string]string // patterns matching the tag values, the series must have all these tags (see MatchTagValue)
+}
+
+// Matches reports whether the series with the given name and tags is selected
+func (s Selector) Matches(name string, tags map[string]string) bool {
+	if s.Name != "" && !matchName(s.Name, name) {
+		return false
+	}
+	for k, value := range s.Tags {
+		if v, ok := tags[k]; !ok || v != value {
+			return false
+		}
+	}
+	for k, pattern := range s.TagPatterns {
+		v, ok := tags[k]
+		if !ok || !MatchTagValue(pattern, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchTagValue reports whether the tag value matches the pattern, where '*' matches any sequence
+// of characters, including '/', '?' matches any single character, and '\' matches the next character
+// literally, so a pattern matching a value with '*', '?' or '\' escapes them.
+func MatchTagValue(pattern, value string) bool {
+	p, v := []rune(pattern), []rune(value)
+	// the position after the last '*' in the pattern and the value position it matches up to, to backtrack
+	star, matched := -1, 0
+	i, j := 0, 0
+	for j < len(v) {
+		switch {
+		case i < len(p) && p[i] == '*':
+			star, matched = i+1, j
+			i++
+			continue
+		case i < len(p) && p[i] == '?':
+			i++
+			j++
+			continue
+		case i+1 < len(p) && p[i] == '\\' && p[i+1] == v[j]:
+			i += 2
+			j++
+			continue
+		case i < len(p) && p[i] != '\\' && p[i] == v[j]:
+			i++
+			j++
+			continue
+		}
+		if star < 0 {
+			return false
+		}
+		// the last '*' matches one more character
+		matched++
+		i, j = star, matched
+	}
+	for i < len(p) && p[i] == '*' {
+		i++
+	}
+	return i == len(p)
+}
+
+// MetricInfo describes a registered series
+type MetricInfo struct {
+	Name   string
+	Tags   map[string]string
+	Type   MetricType
+	Metric interface{}
+}
+
+// FindMetrics returns the registered series matching the selector, sorted by name and tags
+func (r *reporter) FindMetrics(selector Selector) []MetricInfo {
+	r.regMux.RLock()
+	defer r.regMux.RUnlock()
+
+	var res []MetricInfo
+	for _, key := range r.find(selector) {
+		if metric := r.registry.Get(key); metric != nil {
+			name, tags := DecodeKey(key)
+			res = append(res, MetricInfo{Name: name, Tags: tags, Type: TypeOf(metric), Metric: metric})
+		}
+	}
+	return res
+}
+
+// UnregisterWhere unregisters all the series matching the selector and returns how many were removed.
+// No series can be registered through the reporter while they are removed.
+func (r *reporter) UnregisterWhere(selector Selector) int {
+	r.regMux.Lock()
+	defer r.regMux.Unlock()
+
+	keys := r.find(selector)
+	for _, key := range keys {
+		r.unregister(key)
+	}
+	return len(keys)
+}
+
+// find returns the sorted keys of the series matching the selector
+func (r *reporter) find(selector Selector) []string {
+	var keys []string
+	r.registry.Each(func(key string, metric interface{}) {
+		name, tags := DecodeKey(key)
+		if selector.Matches(name, tags) {
+			keys = append(keys, key)
+		}
+	})
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,82 @@
+package reporting
+
+import (
+	"testing"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindMetrics(t *testing.T) {
+	reporter := NewMetricsReporter(newMockSender(), DisableAutoStart(), CustomRegistry(metrics.NewRegistry())).(ExtendedMetricsReporter)
+
+	counter := metrics.NewCounter()
+	reporter.RegisterMetric("db.queries", counter, map[string]string{"tenant": "a", "shard": "1"})
+	reporter.RegisterMetric("db.latency", metrics.NewTimer(), map[string]string{"tenant": "a"})
+	reporter.RegisterMetric("db.latency", metrics.NewTimer(), map[string]string{"tenant": "b"})
+	reporter.RegisterMetric("http.requests", NewHistogram(), map[string]string{"tenant": "a"})
+	reporter.RegisterMetric("uptime", metrics.NewGauge(), nil)
+
+	infos := reporter.FindMetrics(Selector{Name: "db.*", Tags: map[string]string{"tenant": "a"}})
+	assert.Equal(t, []MetricInfo{
+		{Name: "db.latency", Tags: map[string]string{"tenant": "a"}, Type: TypeTimer, Metric: infos[0].Metric},
+		{Name: "db.queries", Tags: map[string]string{"tenant": "a", "shard": "1"}, Type: TypeCounter, Metric: counter},
+	}, infos)
+
+	assert.Equal(t, 5, len(reporter.FindMetrics(Selector{})))
+	assert.Equal(t, 4, len(reporter.FindMetrics(Selector{TagPatterns: map[string]string{"tenant": "*"}})))
+	assert.Empty(t, reporter.FindMetrics(Selector{Name: "db", Tags: map[string]string{"tenant": "a"}}))
+
+	infos = reporter.FindMetrics(Selector{Name: "http.requests"})
+	assert.Equal(t, TypeWavefrontHistogram, infos[0].Type)
+
+	reporter.Close()
+}
+
+func TestUnregisterWhere(t *testing.T) {
+	reporter := NewMetricsReporter(newMockSender(), DisableAutoStart(), CustomRegistry(metrics.NewRegistry())).(ExtendedMetricsReporter)
+
+	for _, tenant := range []string{"a", "b"} {
+		tags := map[string]string{"tenant": tenant}
+		reporter.RegisterMetric("db.queries", metrics.NewCounter(), tags)
+		reporter.RegisterMetric("db.latency", metrics.NewTimer(), tags)
+	}
+	reporter.RegisterMetric("uptime", metrics.NewGauge(), nil)
+
+	assert.Equal(t, 2, reporter.UnregisterWhere(Selector{Tags: map[string]string{"tenant": "a"}}))
+	assert.Nil(t, reporter.GetMetric("db.queries", map[string]string{"tenant": "a"}))
+	assert.Nil(t, reporter.GetMetric("db.latency", map[string]string{"tenant": "a"}))
+	assert.NotNil(t, reporter.GetMetric("db.queries", map[string]string{"tenant": "b"}))
+	assert.NotNil(t, reporter.GetMetric("uptime", nil))
+	assert.Equal(t, 0, reporter.UnregisterWhere(Selector{Tags: map[string]string{"tenant": "a"}}))
+
+	reporter.Close()
+}
+
+func TestSelectorTagValues(t *testing.T) {
+	reporter := NewMetricsReporter(newMockSender(), DisableAutoStart(), CustomRegistry(metrics.NewRegistry())).(ExtendedMetricsReporter)
+
+	reporter.RegisterMetric("requests", metrics.NewCounter(), map[string]string{"tenant": "acme[eu]"})
+	reporter.RegisterMetric("requests", metrics.NewCounter(), map[string]string{"tenant": "acme", "path": "/api/v1/users"})
+	reporter.RegisterMetric("requests", metrics.NewCounter(), map[string]string{"tenant": "a*", "path": "/health"})
+
+	// the tag values are not patterns
+	assert.Equal(t, 1, len(reporter.FindMetrics(Selector{Tags: map[string]string{"tenant": "a*"}})))
+	assert.Equal(t, 1, len(reporter.FindMetrics(Selector{TagPatterns: map[string]string{"path": "/api/*"}})))
+	assert.Equal(t, 2, len(reporter.FindMetrics(Selector{TagPatterns: map[string]string{"path": "*"}})))
+	assert.Equal(t, 1, len(reporter.FindMetrics(Selector{TagPatterns: map[string]string{"tenant": "a\\*"}})))
+	assert.Equal(t, 1, reporter.UnregisterWhere(Selector{Tags: map[string]string{"tenant": "acme[eu]"}}))
+
+	reporter.Close()
+}
+
+func TestMatchTagValue(t *testing.T) {
+	assert.True(t, MatchTagValue("*", ""))
+	assert.True(t, MatchTagValue("/api/*/users", "/api/v1/beta/users"))
+	assert.True(t, MatchTagValue("a?c*", "abcdef"))
+	assert.True(t, MatchTagValue("acme[eu]", "acme[eu]"))
+	assert.True(t, MatchTagValue("\\?\\*\\\\", "?*\\"))
+	assert.False(t, MatchTagValue("\\?", "a"))
+	assert.False(t, MatchTagValue("a*b", "acbc"))
+	assert.False(t, MatchTagValue("abc", "ab"))
+}
@@ -3,6 +3,7 @@ package reporting
 import (
 	"fmt"
 	"reflect"
+	"sync"
 
 	metrics "github.com/rcrowley/go-metrics"
 )
@@ -47,3 +48,114 @@ func UnregisterMetric(name string, tags map[string]string) {
 	key := EncodeKey(name, tags)
 	metrics.Unregister(key)
 }
+
+// extendedRegistry adds to a metrics.Registry the metric types of this package,
+// which the go-metrics registries silently ignore.
+type extendedRegistry struct {
+	metrics.Registry
+	mux     sync.RWMutex
+	metrics map[string]interface{}
+}
+
+func newExtendedRegistry(registry metrics.Registry) *extendedRegistry {
+	return &extendedRegistry{Registry: registry, metrics: make(map[string]interface{})}
+}
+
+// isGoMetric reports whether the metric is one of the types supported by the go-metrics registries
+func isGoMetric(i interface{}) bool {
+	switch i.(type) {
+	case metrics.Counter, metrics.Gauge, metrics.GaugeFloat64, metrics.Healthcheck, metrics.Histogram, metrics.Meter, metrics.Timer:
+		return true
+	}
+	return false
+}
+
+// Each calls the given function for each registered metric.
+func (r *extendedRegistry) Each(f func(string, interface{})) {
+	r.Registry.Each(f)
+
+	r.mux.RLock()
+	extended := make(map[string]interface{}, len(r.metrics))
+	for name, i := range r.metrics {
+		extended[name] = i
+	}
+	r.mux.RUnlock()
+
+	for name, i := range extended {
+		f(name, i)
+	}
+}
+
+// Get the metric by the given name or nil if none is registered.
+func (r *extendedRegistry) Get(name string) interface{} {
+	if i := r.Registry.Get(name); i != nil {
+		return i
+	}
+
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	return r.metrics[name]
+}
+
+// GetOrRegister gets an existing metric or registers the given one.
+// The interface can be the metric to register if not found in registry,
+// or a function returning the metric for lazy instantiation.
+func (r *extendedRegistry) GetOrRegister(name string, i interface{}) interface{} {
+	if metric := r.Get(name); metric != nil {
+		return metric
+	}
+	if v := reflect.ValueOf(i); v.Kind() == reflect.Func {
+		i = v.Call(nil)[0].Interface()
+	}
+	if isGoMetric(i) {
+		return r.Registry.GetOrRegister(name, i)
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if metric, ok := r.metrics[name]; ok {
+		return metric
+	}
+	r.metrics[name] = i
+	return i
+}
+
+// Register the given metric under the given name.
+// Returns a DuplicateMetric if a metric by the given name is already registered.
+func (r *extendedRegistry) Register(name string, i interface{}) error {
+	if isGoMetric(i) {
+		r.mux.RLock()
+		_, ok := r.metrics[name]
+		r.mux.RUnlock()
+		if ok {
+			return metrics.DuplicateMetric(name)
+		}
+		return r.Registry.Register(name, i)
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if _, ok := r.metrics[name]; ok || r.Registry.Get(name) != nil {
+		return metrics.DuplicateMetric(name)
+	}
+	r.metrics[name] = i
+	return nil
+}
+
+// Unregister the metric with the given name.
+func (r *extendedRegistry) Unregister(name string) {
+	r.Registry.Unregister(name)
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	delete(r.metrics, name)
+}
+
+// UnregisterAll unregisters all metrics.
+func (r *extendedRegistry) UnregisterAll() {
+	r.Registry.UnregisterAll()
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.metrics = make(map[string]interface{})
+}
@@ -48,6 +48,32 @@ type WavefrontMetricsReporter interface {
 	UnregisterMetric(name string, tags map[string]string)
 }
 
+// ExtendedMetricsReporter adds to WavefrontMetricsReporter the APIs added since, kept apart so the
+// implementations of WavefrontMetricsReporter outside of this package still implement it.
+// The reporters created by NewMetricsReporter implement it.
+type ExtendedMetricsReporter interface {
+	WavefrontMetricsReporter
+
+	// FlushAll completes the current time slices of the Wavefront histograms and timers, and reports the metrics.
+	// Called on Close so the samples of the current time slices are not lost.
+	FlushAll()
+
+	// RegisterMetricWithOptions is RegisterMetric with options customizing how the series is reported.
+	RegisterMetricWithOptions(name string, metric interface{}, tags map[string]string, options ...RegisterOption) error
+
+	// GetOrRegisterMetricWithOptions is GetOrRegisterMetric with options customizing how the series is reported.
+	GetOrRegisterMetricWithOptions(name string, i interface{}, tags map[string]string, options ...RegisterOption) interface{}
+
+	// AnalyzeCardinality groups the registered series by metric name, keeping the top most used values of every tag key.
+	AnalyzeCardinality(top int) CardinalityReport
+
+	// FindMetrics returns the registered series matching the selector, sorted by name and tags.
+	FindMetrics(selector Selector) []MetricInfo
+
+	// UnregisterWhere unregisters all the series matching the selector and returns how many were removed.
+	UnregisterWhere(selector Selector) int
+}
+
 type reporter struct {
 	sender        wf.Sender
 	application   application.Tags
@@ -56,9 +82,8 @@ type reporter struct {
 	addSuffix     bool
 	interval      time.Duration
 	ticker        *time.Ticker
-	percentiles   []float64              // Percentiles to export from timers and histograms
-	durationUnit  time.Duration          // Time conversion unit for durations
-	metrics       map[string]interface{} // for Wavefron specific metrics tyoes, like Histograms
+	percentiles   []float64     // Percentiles to export from timers and histograms
+	durationUnit  time.Duration // Time conversion unit for durations
 	errors        chan error
 	start         chan bool
 	close         chan bool
@@ -66,8 +91,29 @@ type reporter struct {
 	errorDebug    bool
 	autoStart     bool
 	mux           sync.Mutex
+	closed        bool         // set once the reporter is closed, guarded by mux
+	regMux        sync.RWMutex // held for writing while series are unregistered in bulk
 	registry      metrics.Registry
 	runtimeMetric bool // for getting the go runtime metrics
+	cardinality   *cardinalityLimiter
+	types         *typeTracker
+
+	cardinalityMetrics bool // for reporting the number of series per metric name
+
+	expireIdle  int          // number of idle reporting intervals before a series is unregistered
+	expireRules []expiryRule // per metric name overrides of expireIdle
+	onExpire    ExpireCallback
+
+	seriesMux sync.Mutex
+	series    map[string]*seriesState // per registry key state kept between reporting cycles
+	cycle     int64
+
+	deltaPatterns        []string  // plain counters reported as delta counters
+	countMode            CountMode // how the counts of meters, timers and histograms are reported
+	distributionPatterns []string  // go-metrics histograms and timers reported as distributions
+	distributionStats    bool      // report the statistics of the Wavefront histograms and timers distributions
+	deltaCarryLimit      float64   // max delta counter amount carried forward after a failed send
+	deltaDropped         float64   // delta counter amount dropped because of deltaCarryLimit
 }
 
 // Option allows WavefrontReporter customization
@@ -136,7 +182,7 @@ func ApplicationTag(application application.Tags) Option {
 	}
 }
 
-// NewMetricsReporter create a WavefrontMetricsReporter
+// NewMetricsReporter create a WavefrontMetricsReporter, which is also an ExtendedMetricsReporter
 func NewMetricsReporter(sender wf.Sender, setters ...Option) WavefrontMetricsReporter {
 	r := &reporter{
 		sender:        sender,
@@ -144,11 +190,13 @@ func NewMetricsReporter(sender wf.Sender, setters ...Option) WavefrontMetricsRep
 		interval:      time.Second * 5,
 		percentiles:   []float64{0.5, 0.75, 0.95, 0.99, 0.999},
 		durationUnit:  time.Nanosecond,
-		metrics:       make(map[string]interface{}),
 		addSuffix:     true,
 		errorsCount:   0,
 		autoStart:     true,
 		runtimeMetric: false,
+		cardinality:   newCardinalityLimiter(),
+		types:         newTypeTracker(),
+		series:        make(map[string]*seriesState),
 	}
 
 	for _, setter := range setters {
@@ -158,6 +206,7 @@ func NewMetricsReporter(sender wf.Sender, setters ...Option) WavefrontMetricsRep
 	if r.registry == nil {
 		r.registry = metrics.DefaultRegistry
 	}
+	r.registry = newExtendedRegistry(r.registry) // for Wavefront specific metrics types, like CounterFloat64
 
 	if r.runtimeMetric == true {
 		metrics.RegisterRuntimeMemStats(r.registry)
@@ -170,6 +219,7 @@ func NewMetricsReporter(sender wf.Sender, setters ...Option) WavefrontMetricsRep
 
 	go func() {
 		running := false
+		flushed := make(chan bool)
 		for {
 			select {
 			case <-r.ticker.C:
@@ -186,7 +236,17 @@ func NewMetricsReporter(sender wf.Sender, setters ...Option) WavefrontMetricsRep
 			case <-r.start:
 				running = true
 			case <-r.close:
-				r.Report()
+				r.ticker.Stop()
+				// reported asynchronously as the errors are received by this goroutine
+				go func() {
+					r.FlushAll()
+					// the later reports, which would block on the errors once this goroutine returns, are skipped
+					r.mux.Lock()
+					r.closed = true
+					r.mux.Unlock()
+					flushed <- true
+				}()
+			case <-flushed:
 				r.sender.Close()
 				return
 			}
@@ -211,6 +271,9 @@ func (r *reporter) ErrorsCount() int64 {
 func (r *reporter) Report() {
 	r.mux.Lock()
 	defer r.mux.Unlock()
+	if r.closed {
+		return
+	}
 
 	lastErrorsCount := r.ErrorsCount()
 
@@ -218,58 +281,140 @@ func (r *reporter) Report() {
 		metrics.CaptureRuntimeMemStatsOnce(r.registry)
 	}
 
+	r.nextCycle()
+
 	r.registry.Each(func(key string, metric interface{}) {
 		name, tags := DecodeKey(key)
-
-		for t, v := range r.application.Map() {
-			if _, ok := tags[t]; !ok && len(v) > 0 {
-				tags[t] = v
-			}
+		if r.observe(key, name, metric) {
+			r.expire(key, metric)
+			return
 		}
+		r.addApplicationTags(tags)
 
 		switch metric.(type) {
 		case metrics.Counter:
 			if hasDeltaPrefix(name) {
-				r.reportDelta(name, metric.(metrics.Counter), tags)
+				r.reportDelta(key, name, metric.(metrics.Counter), tags)
+			} else if r.asDelta(key, name) {
+				r.reportCounterDelta(key, name, float64(metric.(metrics.Counter).Count()), tags)
 			} else {
 				r.errors <- r.sender.SendMetric(r.prepareName(name, "count"), float64(metric.(metrics.Counter).Count()), 0, r.source, tags)
 			}
+		case CounterFloat64:
+			if hasDeltaPrefix(name) {
+				r.reportDeltaFloat64(key, name, metric.(CounterFloat64), tags)
+			} else if r.asDelta(key, name) {
+				r.reportCounterDelta(key, name, metric.(CounterFloat64).Count(), tags)
+			} else {
+				r.errors <- r.sender.SendMetric(r.prepareName(name, "count"), metric.(CounterFloat64).Count(), 0, r.source, tags)
+			}
 		case metrics.Gauge:
 			r.errors <- r.sender.SendMetric(r.prepareName(name, "value"), float64(metric.(metrics.Gauge).Value()), 0, r.source, tags)
 		case metrics.GaugeFloat64:
 			r.errors <- r.sender.SendMetric(r.prepareName(name, "value"), float64(metric.(metrics.GaugeFloat64).Value()), 0, r.source, tags)
 		case Histogram:
 			r.reportWFHistogram(name, metric.(Histogram), tags)
+		case WindowedHistogram:
+			if r.asDistribution(key, name) {
+				r.reportHistogramDistribution(key, name, metric.(WindowedHistogram).swap(), tags)
+			} else {
+				r.reportHistogram(key, name, metric.(WindowedHistogram).swap(), tags)
+			}
 		case metrics.Histogram:
-			r.reportHistogram(name, metric.(metrics.Histogram), tags)
+			if r.asDistribution(key, name) {
+				r.reportHistogramDistribution(key, name, metric.(metrics.Histogram), tags)
+			} else {
+				r.reportHistogram(key, name, metric.(metrics.Histogram), tags)
+			}
 		case metrics.Meter:
-			r.reportMeter(name, metric.(metrics.Meter), tags)
+			r.reportMeter(key, name, metric.(metrics.Meter), tags)
+		case Timer:
+			r.reportWFTimer(key, name, metric.(Timer), tags)
+		case WindowedTimer:
+			if r.asDistribution(key, name) {
+				r.reportTimerDistribution(key, name, metric.(WindowedTimer).swap(), tags)
+			} else {
+				r.reportTimer(key, name, metric.(WindowedTimer).swap(), tags)
+			}
 		case metrics.Timer:
-			r.reportTimer(name, metric.(metrics.Timer), tags)
+			if r.asDistribution(key, name) {
+				r.reportTimerDistribution(key, name, metric.(metrics.Timer), tags)
+			} else {
+				r.reportTimer(key, name, metric.(metrics.Timer), tags)
+			}
+		case *BucketHistogram:
+			r.reportBucketHistogram(key, name, metric.(*BucketHistogram), tags)
+		case *TopK:
+			r.reportTopK(name, metric.(*TopK), tags)
 		}
 	})
+	r.sweepSeries()
+	r.reportInternalMetrics()
+
 	actualErrorsCount := r.ErrorsCount()
 	if actualErrorsCount != lastErrorsCount {
 		log.Printf("!!! There was %d errors on the last reporting cycle !!!", (actualErrorsCount - lastErrorsCount))
 	}
 }
 
-func (r *reporter) reportDelta(name string, metric metrics.Counter, tags map[string]string) {
-	var prunedName string
-	if strings.HasPrefix(name, deltaPrefix) {
-		prunedName = name[deltaPrefixSize:]
-	} else if strings.HasPrefix(name, altDeltaPrefix) {
-		prunedName = name[altDeltaPrefixSize:]
+// addApplicationTags adds the application tags not already set on the metric
+func (r *reporter) addApplicationTags(tags map[string]string) map[string]string {
+	for t, v := range r.application.Map() {
+		if _, ok := tags[t]; !ok && len(v) > 0 {
+			tags[t] = v
+		}
 	}
+	return tags
+}
+
+func (r *reporter) reportDelta(key, name string, metric metrics.Counter, tags map[string]string) {
 	value := metric.Count()
 	metric.Dec(value)
 
-	r.errors <- r.sender.SendDeltaCounter(deltaPrefix+r.prepareName(prunedName, "count"), float64(value), r.source, tags)
+	r.sendDelta(key, r.deltaName(name), float64(value), tags)
+}
+
+func (r *reporter) reportDeltaFloat64(key, name string, metric CounterFloat64, tags map[string]string) {
+	value := metric.Count()
+	metric.Dec(value)
+
+	r.sendDelta(key, r.deltaName(name), value, tags)
 }
 
 func (r *reporter) reportWFHistogram(metricName string, h Histogram, tags map[string]string) {
-	distributions := h.Distributions()
-	hgs := map[histogram.Granularity]bool{h.Granularity(): true}
+	distributions := h.DistributionsByGranularity()
+	for _, g := range h.Granularities() {
+		r.sendDistributions(metricName, distributions[g], g, tags)
+	}
+	if r.distributionStats {
+		r.reportDistributionStats(metricName, distributions[h.Granularity()], true, tags)
+	}
+}
+
+func (r *reporter) reportWFTimer(key, name string, t Timer, tags map[string]string) {
+	du := float64(r.durationUnit)
+	distributions := t.DistributionsByGranularity()
+	for _, g := range t.Granularities() {
+		for _, distribution := range distributions[g] {
+			for i := range distribution.Centroids {
+				distribution.Centroids[i].Value /= du
+			}
+		}
+		r.sendDistributions(name, distributions[g], g, tags)
+	}
+	if r.distributionStats {
+		r.reportDistributionStats(name, distributions[t.Granularity()], false, tags)
+	}
+
+	r.reportCount(key, name, t.Count(), tags)
+	r.errors <- r.sender.SendMetric(r.prepareName(name+".one-minute"), t.Rate1(), 0, r.source, tags)
+	r.errors <- r.sender.SendMetric(r.prepareName(name+".five-minute"), t.Rate5(), 0, r.source, tags)
+	r.errors <- r.sender.SendMetric(r.prepareName(name+".fifteen-minute"), t.Rate15(), 0, r.source, tags)
+	r.errors <- r.sender.SendMetric(r.prepareName(name+".mean-rate"), t.RateMean(), 0, r.source, tags)
+}
+
+func (r *reporter) sendDistributions(metricName string, distributions []histogram.Distribution, granularity histogram.Granularity, tags map[string]string) {
+	hgs := map[histogram.Granularity]bool{granularity: true}
 	for _, distribution := range distributions {
 		if len(distribution.Centroids) > 0 {
 			r.errors <- r.sender.SendDistribution(r.prepareName(metricName), distribution.Centroids, hgs, distribution.Timestamp.Unix(), r.source, tags)
@@ -277,41 +422,39 @@ func (r *reporter) reportWFHistogram(metricName string, h Histogram, tags map[st
 	}
 }
 
-func (r *reporter) reportHistogram(name string, metric metrics.Histogram, tags map[string]string) {
+func (r *reporter) reportHistogram(key, name string, metric metrics.Histogram, tags map[string]string) {
 	h := metric.Snapshot()
 	ps := h.Percentiles(r.percentiles)
-	r.errors <- r.sender.SendMetric(r.prepareName(name+".count"), float64(h.Count()), 0, r.source, tags)
+	r.reportCount(key, name, h.Count(), tags)
 	r.errors <- r.sender.SendMetric(r.prepareName(name+".min"), float64(h.Min()), 0, r.source, tags)
 	r.errors <- r.sender.SendMetric(r.prepareName(name+".max"), float64(h.Max()), 0, r.source, tags)
 	r.errors <- r.sender.SendMetric(r.prepareName(name+".mean"), h.Mean(), 0, r.source, tags)
 	r.errors <- r.sender.SendMetric(r.prepareName(name+".std-dev"), h.StdDev(), 0, r.source, tags)
 	for psIdx, psKey := range r.percentiles {
-		key := strings.Replace(strconv.FormatFloat(psKey*100.0, 'f', -1, 64), ".", "", 1)
-		r.errors <- r.sender.SendMetric(r.prepareName(name+"."+key+"-percentile"), ps[psIdx], 0, r.source, tags)
+		r.errors <- r.sender.SendMetric(r.prepareName(name+"."+percentileName(psKey)), ps[psIdx], 0, r.source, tags)
 	}
 }
 
-func (r *reporter) reportMeter(name string, metric metrics.Meter, tags map[string]string) {
+func (r *reporter) reportMeter(key, name string, metric metrics.Meter, tags map[string]string) {
 	m := metric.Snapshot()
-	r.errors <- r.sender.SendMetric(r.prepareName(name+".count"), float64(m.Count()), 0, r.source, tags)
+	r.reportCount(key, name, m.Count(), tags)
 	r.errors <- r.sender.SendMetric(r.prepareName(name+".one-minute"), m.Rate1(), 0, r.source, tags)
 	r.errors <- r.sender.SendMetric(r.prepareName(name+".five-minute"), m.Rate5(), 0, r.source, tags)
 	r.errors <- r.sender.SendMetric(r.prepareName(name+".fifteen-minute"), m.Rate15(), 0, r.source, tags)
 	r.errors <- r.sender.SendMetric(r.prepareName(name+".mean"), m.RateMean(), 0, r.source, tags)
 }
 
-func (r *reporter) reportTimer(name string, metric metrics.Timer, tags map[string]string) {
+func (r *reporter) reportTimer(key, name string, metric metrics.Timer, tags map[string]string) {
 	t := metric.Snapshot()
 	du := float64(r.durationUnit)
 	ps := t.Percentiles(r.percentiles)
-	r.errors <- r.sender.SendMetric(r.prepareName(name+".count"), float64(t.Count()), 0, r.source, tags)
+	r.reportCount(key, name, t.Count(), tags)
 	r.errors <- r.sender.SendMetric(r.prepareName(name+".min"), float64(t.Min()/int64(du)), 0, r.source, tags)
 	r.errors <- r.sender.SendMetric(r.prepareName(name+".max"), float64(t.Max()/int64(du)), 0, r.source, tags)
 	r.errors <- r.sender.SendMetric(r.prepareName(name+".mean"), t.Mean()/du, 0, r.source, tags)
 	r.errors <- r.sender.SendMetric(r.prepareName(name+".std-dev"), t.StdDev()/du, 0, r.source, tags)
 	for psIdx, psKey := range r.percentiles {
-		key := strings.Replace(strconv.FormatFloat(psKey*100.0, 'f', -1, 64), ".", "", 1)
-		r.errors <- r.sender.SendMetric(r.prepareName(name+"."+key+"-percentile"), ps[psIdx]/du, 0, r.source, tags)
+		r.errors <- r.sender.SendMetric(r.prepareName(name+"."+percentileName(psKey)), ps[psIdx]/du, 0, r.source, tags)
 	}
 	r.errors <- r.sender.SendMetric(r.prepareName(name+".one-minute"), t.Rate1(), 0, r.source, tags)
 	r.errors <- r.sender.SendMetric(r.prepareName(name+".five-minute"), t.Rate5(), 0, r.source, tags)
@@ -319,6 +462,11 @@ func (r *reporter) reportTimer(name string, metric metrics.Timer, tags map[strin
 	r.errors <- r.sender.SendMetric(r.prepareName(name+".mean-rate"), t.RateMean(), 0, r.source, tags)
 }
 
+// percentileName returns the suffix of a percentile metric name, like '99-percentile' or '999-percentile'
+func percentileName(p float64) string {
+	return strings.Replace(strconv.FormatFloat(p*100.0, 'f', -1, 64), ".", "", 1) + "-percentile"
+}
+
 func (r *reporter) prepareName(name string, suffix ...string) string {
 	if len(r.prefix) > 0 {
 		name = r.prefix + "." + name
@@ -333,6 +481,19 @@ func (r *reporter) prepareName(name string, suffix ...string) string {
 	return name
 }
 
+func (r *reporter) FlushAll() {
+	r.registry.Each(func(key string, metric interface{}) {
+		// the histograms with a custom time supplier cannot be flushed, their completed time slices are still reported
+		switch m := metric.(type) {
+		case Histogram:
+			m.Flush()
+		case Timer:
+			m.Flush()
+		}
+	})
+	r.Report()
+}
+
 func (r *reporter) Start() {
 	r.start <- true
 }
@@ -351,7 +512,24 @@ func (err RegistryError) Error() string {
 // RegisterMetric register the given metric under the given name and tags
 // return RegistryError if the metric is not registered
 func (r *reporter) RegisterMetric(name string, metric interface{}, tags map[string]string) error {
+	return r.RegisterMetricWithOptions(name, metric, tags)
+}
+
+// RegisterMetricWithOptions register the given metric under the given name and tags, reported as customized by the options
+// return RegistryError if the metric is not registered
+func (r *reporter) RegisterMetricWithOptions(name string, metric interface{}, tags map[string]string, options ...RegisterOption) error {
+	r.regMux.RLock()
+	defer r.regMux.RUnlock()
+
+	tags, folded := r.cardinality.admit(name, tags)
 	key := EncodeKey(name, tags)
+	if folded && r.registry.Get(key) != nil {
+		return RegistryError(fmt.Sprintf("Metric '%s' over its cardinality limit, folded into the existing overflow series.", name))
+	}
+	if err := r.types.admit(name, key, metric); err != nil {
+		r.cardinality.forget(name, tags)
+		return err
+	}
 	err := r.registry.Register(key, metric)
 	if err != nil {
 		return err
@@ -360,27 +538,58 @@ func (r *reporter) RegisterMetric(name string, metric interface{}, tags map[stri
 	if m == nil {
 		return RegistryError(fmt.Sprintf("Metric '%s'(%s) not registered.", name, reflect.TypeOf(metric).String()))
 	}
+	r.configure(key, options)
 	return nil
 }
 
 // GetMetric get the metric by the given name and tags or nil if none is registered.
 func (r *reporter) GetMetric(name string, tags map[string]string) interface{} {
-	key := EncodeKey(name, tags)
+	key := EncodeKey(name, r.cardinality.resolve(name, tags))
+	r.touch(key)
 	return r.registry.Get(key)
 }
 
 // GetOrRegisterMetric gets an existing metric or registers the given one.
 // The interface can be the metric to register if not found in registry,
 // or a function returning the metric for lazy instantiation.
+// Returns nil if the metric type conflicts with the other series of the same name and
+// the reporter rejects type conflicts.
 func (r *reporter) GetOrRegisterMetric(name string, i interface{}, tags map[string]string) interface{} {
+	return r.GetOrRegisterMetricWithOptions(name, i, tags)
+}
+
+// GetOrRegisterMetricWithOptions gets an existing metric or registers the given one, reported as customized by the options.
+func (r *reporter) GetOrRegisterMetricWithOptions(name string, i interface{}, tags map[string]string, options ...RegisterOption) interface{} {
+	r.regMux.RLock()
+	defer r.regMux.RUnlock()
+
+	tags, _ = r.cardinality.admit(name, tags)
 	key := EncodeKey(name, tags)
-	return r.registry.GetOrRegister(key, i)
+	r.touch(key)
+	if r.types.enabled() {
+		if metric := r.registry.Get(key); metric != nil {
+			return metric
+		}
+		if v := reflect.ValueOf(i); v.Kind() == reflect.Func {
+			i = v.Call(nil)[0].Interface()
+		}
+		if err := r.types.admit(name, key, i); err != nil {
+			r.cardinality.forget(name, tags)
+			log.Printf("reporter error: %v\n", err)
+			return nil
+		}
+	}
+	metric := r.registry.GetOrRegister(key, i)
+	r.configure(key, options)
+	return metric
 }
 
 // UnregisterMetric Unregister the metric with the given name.
 func (r *reporter) UnregisterMetric(name string, tags map[string]string) {
-	key := EncodeKey(name, tags)
-	r.registry.Unregister(key)
+	r.regMux.RLock()
+	defer r.regMux.RUnlock()
+
+	r.unregister(EncodeKey(name, tags))
 }
 
 func hostname() string {
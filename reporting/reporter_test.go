@@ -183,6 +183,40 @@ func TestDeltaPoint(t *testing.T) {
 	reporter.Close()
 }
 
+func TestDeltaCarryForward(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(), CustomRegistry(metrics.NewRegistry()), DeltaCarryLimit(25))
+
+	counter := metrics.NewCounter()
+	reporter.RegisterMetric(DeltaCounterName("foo"), counter, nil)
+
+	sender.DeltaErr = fmt.Errorf("unavailable")
+	counter.Inc(10)
+	reporter.Report()
+	counter.Inc(10)
+	reporter.Report()
+	assert.Equal(t, int64(0), counter.Count())
+
+	sender.DeltaErr = nil
+	counter.Inc(1)
+	reporter.Report()
+	assert.Equal(t, []MockMetirc{{Name: deltaPrefix + "foo.count", Tags: map[string]string{}, Value: 21}}, sender.Deltas)
+
+	sender.DeltaErr = fmt.Errorf("unavailable")
+	counter.Inc(20)
+	reporter.Report()
+	counter.Inc(20)
+	reporter.Report()
+
+	sender.DeltaErr = nil
+	reporter.Report()
+	assert.Equal(t, float64(25), sender.Deltas[1].Value)
+	assert.Equal(t, MockMetirc{Name: internalPrefix + "delta.dropped.count", Tags: map[string]string{}, Value: 15},
+		sender.Metrics[len(sender.Metrics)-1])
+
+	reporter.Close()
+}
+
 func newMockSender() *MockSender {
 	return &MockSender{
 		Distributions: make([]MockMetirc, 0),
@@ -192,18 +226,33 @@ func newMockSender() *MockSender {
 }
 
 type MockMetirc struct {
-	Name string
-	Tags map[string]string
+	Name          string
+	Tags          map[string]string
+	Value         float64
+	Centroids     []histogram.Centroid
+	Granularities map[histogram.Granularity]bool
 }
 
 type MockSender struct {
 	Distributions []MockMetirc
 	Metrics       []MockMetirc
 	Deltas        []MockMetirc
+	DeltaErr      error // returned by SendDeltaCounter when set
+	closed        bool
 	sync.Mutex
 }
 
-func (s *MockSender) Close() {}
+func (s *MockSender) Close() {
+	s.Lock()
+	defer s.Unlock()
+	s.closed = true
+}
+
+func (s *MockSender) isClosed() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.closed
+}
 
 func (s *MockSender) SendEvent(name string, startMillis, endMillis int64, source string, tags map[string]string, setters ...event.Option) error {
 	return nil
@@ -216,14 +265,17 @@ func (s *MockSender) SendSpan(name string, startMillis, durationMillis int64, so
 func (s *MockSender) SendDistribution(name string, centroids []histogram.Centroid, hgs map[histogram.Granularity]bool, ts int64, source string, tags map[string]string) error {
 	s.Lock()
 	defer s.Unlock()
-	s.Distributions = append(s.Distributions, MockMetirc{Name: name, Tags: tags})
+	s.Distributions = append(s.Distributions, MockMetirc{Name: name, Tags: tags, Centroids: centroids, Granularities: hgs})
 	return nil
 }
 
 func (s *MockSender) SendDeltaCounter(name string, value float64, source string, tags map[string]string) error {
 	s.Lock()
 	defer s.Unlock()
-	s.Deltas = append(s.Deltas, MockMetirc{Name: name, Tags: tags})
+	if s.DeltaErr != nil {
+		return s.DeltaErr
+	}
+	s.Deltas = append(s.Deltas, MockMetirc{Name: name, Tags: tags, Value: value})
 	return nil
 }
 
@@ -233,7 +285,7 @@ func (s *MockSender) SendMetric(name string, value float64, ts int64, source str
 	}
 	s.Lock()
 	defer s.Unlock()
-	s.Metrics = append(s.Metrics, MockMetirc{Name: name, Tags: tags})
+	s.Metrics = append(s.Metrics, MockMetirc{Name: name, Tags: tags, Value: value})
 	return nil
 }
 
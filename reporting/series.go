@@ -0,0 +1,88 @@
+package reporting
+
+// seriesState holds what the reporter remembers about a registered series between reporting cycles
+type seriesState struct {
+	cycle       int64       // last reporting cycle the series was seen in the registry
+	fingerprint interface{} // last observed value, to detect idle series
+	idle        int         // number of reporting cycles the series has been idle
+
+	pending        map[string]float64 // delta counter amounts not accepted by the sender yet, by delta counter name
+	last           map[string]float64 // cumulative values reported as delta counters during the previous cycle, by delta counter name
+	asDelta        bool               // report the counter as a delta counter
+	asDistribution bool               // report the go-metrics histogram or timer as a distribution
+	lastCount      int64              // count of the go-metrics histogram or timer reported as a distribution during the previous cycle
+}
+
+// state returns the state of the series with the given key, creating it if needed.
+// Must be called with r.seriesMux held.
+func (r *reporter) state(key string) *seriesState {
+	st, ok := r.series[key]
+	if !ok {
+		st = &seriesState{cycle: r.cycle}
+		r.series[key] = st
+	}
+	return st
+}
+
+// configure applies the registration options to the series with the given key
+func (r *reporter) configure(key string, options []RegisterOption) {
+	if len(options) == 0 {
+		return
+	}
+
+	r.seriesMux.Lock()
+	defer r.seriesMux.Unlock()
+
+	st := r.state(key)
+	for _, option := range options {
+		option(st)
+	}
+}
+
+// nextCycle starts a new reporting cycle
+func (r *reporter) nextCycle() {
+	r.seriesMux.Lock()
+	defer r.seriesMux.Unlock()
+
+	r.cycle++
+}
+
+// observe records that the series has been seen in the current reporting cycle,
+// and returns true if it has been idle for too long and must be expired.
+func (r *reporter) observe(key, name string, metric interface{}) bool {
+	r.seriesMux.Lock()
+	defer r.seriesMux.Unlock()
+
+	st := r.state(key)
+	st.cycle = r.cycle
+	return r.idle(st, name, metric)
+}
+
+// sweepSeries forgets the series not seen during the current reporting cycle,
+// which have been unregistered without going through the reporter.
+func (r *reporter) sweepSeries() {
+	r.seriesMux.Lock()
+	defer r.seriesMux.Unlock()
+
+	for key, st := range r.series {
+		if st.cycle != r.cycle {
+			name, tags := DecodeKey(key)
+			r.types.forget(name, key)
+			r.cardinality.forget(name, tags)
+			delete(r.series, key)
+		}
+	}
+}
+
+// unregister removes the series with the given key and everything the reporter knows about it
+func (r *reporter) unregister(key string) {
+	r.registry.Unregister(key)
+
+	name, tags := DecodeKey(key)
+	r.cardinality.forget(name, tags)
+	r.types.forget(name, key)
+
+	r.seriesMux.Lock()
+	delete(r.series, key)
+	r.seriesMux.Unlock()
+}
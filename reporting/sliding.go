@@ -0,0 +1,340 @@
+package reporting
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/wavefronthq/wavefront-sdk-go/histogram"
+)
+
+// SlidingWindowSample is a metrics.Sample keeping the values recorded during a fixed time window,
+// like the last 60 seconds. The window is split into sub-windows kept in a ring buffer, each of them
+// sampling its values in a reservoir of a fixed size, so the window slides by sub-window and its
+// memory is bounded. When a sub-window records more values than its reservoir can hold, its values
+// are weighted accordingly in the statistics.
+// As the go-metrics histograms only accept their own sample snapshots, Snapshot returns a subset of
+// the values in which every value is given the same weight, while the statistics of the sample are
+// computed from all its values.
+type SlidingWindowSample struct {
+	mutex         sync.Mutex
+	clock         func() time.Time
+	subWindow     time.Duration
+	reservoirSize int
+	windows       []sampleWindow
+}
+
+type sampleWindow struct {
+	start  time.Time
+	count  int64
+	values []int64
+}
+
+// NewSlidingWindowSample creates a SlidingWindowSample keeping the values of the given time window,
+// split into the given number of sub-windows with a reservoir of the given size each.
+// The sub-windows last at least 1ns and the reservoirs hold at least 1 value.
+func NewSlidingWindowSample(window time.Duration, subWindows, reservoirSize int) metrics.Sample {
+	return newSlidingWindowSample(time.Now, window, subWindows, reservoirSize)
+}
+
+func newSlidingWindowSample(clock func() time.Time, window time.Duration, subWindows, reservoirSize int) *SlidingWindowSample {
+	if subWindows < 1 {
+		subWindows = 1
+	}
+	subWindow := window / time.Duration(subWindows)
+	if subWindow < 1 {
+		subWindow = 1
+	}
+	if reservoirSize < 1 {
+		reservoirSize = 1
+	}
+	return &SlidingWindowSample{
+		clock:         clock,
+		subWindow:     subWindow,
+		reservoirSize: reservoirSize,
+		windows:       make([]sampleWindow, subWindows),
+	}
+}
+
+// live reports whether the sub-window holds values of the time window ending now
+func (s *SlidingWindowSample) live(w sampleWindow, now time.Time) bool {
+	return w.count > 0 && now.Sub(w.start) < s.subWindow*time.Duration(len(s.windows))
+}
+
+// Clear clears all samples.
+func (s *SlidingWindowSample) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := range s.windows {
+		s.windows[i] = sampleWindow{}
+	}
+}
+
+// Count returns the number of values recorded during the time window.
+func (s *SlidingWindowSample) Count() int64 {
+	return s.weighted().Count()
+}
+
+// Max returns the maximum value of the sample.
+func (s *SlidingWindowSample) Max() int64 {
+	return s.weighted().Max()
+}
+
+// Mean returns the mean of the values recorded during the time window.
+func (s *SlidingWindowSample) Mean() float64 {
+	return s.weighted().Mean()
+}
+
+// Min returns the minimum value of the sample.
+func (s *SlidingWindowSample) Min() int64 {
+	return s.weighted().Min()
+}
+
+// Percentile returns an arbitrary percentile of the values recorded during the time window.
+func (s *SlidingWindowSample) Percentile(p float64) float64 {
+	return s.weighted().Percentile(p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the values recorded during the time window.
+func (s *SlidingWindowSample) Percentiles(ps []float64) []float64 {
+	return s.weighted().Percentiles(ps)
+}
+
+// Size returns the number of values in the sample, which is at most the number of sub-windows
+// times the reservoir size.
+func (s *SlidingWindowSample) Size() int {
+	return s.weighted().Size()
+}
+
+// Snapshot returns a read-only copy of the values of the time window in which every value stands for
+// the same number of recorded values, some values of the sub-windows which recorded fewer values than
+// the others are left out.
+func (s *SlidingWindowSample) Snapshot() metrics.Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.clock()
+	weight := 0.0
+	for _, w := range s.windows {
+		if s.live(w, now) {
+			weight = math.Max(weight, float64(w.count)/float64(len(w.values)))
+		}
+	}
+	var count int64
+	var values []int64
+	for _, w := range s.windows {
+		if !s.live(w, now) {
+			continue
+		}
+		count += w.count
+		// keep a random subset of the values so every kept value stands for the same number of recorded values
+		kept := append([]int64{}, w.values...)
+		n := int(math.Max(1, math.Round(float64(w.count)/weight)))
+		for i := 0; i < n; i++ {
+			j := i + rand.Intn(len(kept)-i)
+			kept[i], kept[j] = kept[j], kept[i]
+		}
+		values = append(values, kept[:n]...)
+	}
+	return metrics.NewSampleSnapshot(count, values)
+}
+
+// weighted returns a copy of the values of the time window, each of them weighted by the number of
+// values it stands for.
+func (s *SlidingWindowSample) weighted() *weightedSample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.clock()
+	snapshot := &weightedSample{}
+	for _, w := range s.windows {
+		if !s.live(w, now) {
+			continue
+		}
+		weight := float64(w.count) / float64(len(w.values))
+		for _, v := range w.values {
+			snapshot.values = append(snapshot.values, weightedValue{value: v, weight: weight})
+		}
+		snapshot.count += w.count
+	}
+	sort.Slice(snapshot.values, func(i, j int) bool {
+		return snapshot.values[i].value < snapshot.values[j].value
+	})
+	return snapshot
+}
+
+// StdDev returns the standard deviation of the values recorded during the time window.
+func (s *SlidingWindowSample) StdDev() float64 {
+	return s.weighted().StdDev()
+}
+
+// Sum returns the estimated sum of the values recorded during the time window.
+func (s *SlidingWindowSample) Sum() int64 {
+	return s.weighted().Sum()
+}
+
+// Update samples a new value.
+func (s *SlidingWindowSample) Update(v int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.clock()
+	start := now.Truncate(s.subWindow)
+	w := &s.windows[(start.UnixNano()/int64(s.subWindow))%int64(len(s.windows))]
+	if !w.start.Equal(start) {
+		*w = sampleWindow{start: start, values: w.values[:0]}
+	}
+	w.count++
+	if len(w.values) < s.reservoirSize {
+		w.values = append(w.values, v)
+	} else if r := rand.Int63n(w.count); r < int64(s.reservoirSize) {
+		w.values[r] = v
+	}
+}
+
+// Values returns a copy of the values in the sample, sorted.
+func (s *SlidingWindowSample) Values() []int64 {
+	return s.weighted().Values()
+}
+
+// Variance returns the variance of the values recorded during the time window.
+func (s *SlidingWindowSample) Variance() float64 {
+	return s.weighted().Variance()
+}
+
+// centroids returns the values of the sample with the number of values they stand for as counts
+func (s *SlidingWindowSample) centroids() []histogram.Centroid {
+	return s.weighted().centroids()
+}
+
+type weightedValue struct {
+	value  int64
+	weight float64 // number of recorded values represented by the value
+}
+
+// weightedSample is a read-only copy of the values of a SlidingWindowSample, with their weights.
+type weightedSample struct {
+	values []weightedValue // sorted by value
+	count  int64
+}
+
+// Count returns the number of values recorded during the time window at the time the copy was made.
+func (s *weightedSample) Count() int64 { return s.count }
+
+// Max returns the maximal value at the time the copy was made.
+func (s *weightedSample) Max() int64 {
+	if len(s.values) == 0 {
+		return 0
+	}
+	return s.values[len(s.values)-1].value
+}
+
+// Mean returns the mean value at the time the copy was made.
+func (s *weightedSample) Mean() float64 {
+	if s.count == 0 {
+		return 0
+	}
+	return s.sum() / float64(s.count)
+}
+
+// Min returns the minimal value at the time the copy was made.
+func (s *weightedSample) Min() int64 {
+	if len(s.values) == 0 {
+		return 0
+	}
+	return s.values[0].value
+}
+
+// Percentile returns an arbitrary percentile of values at the time the copy was made.
+func (s *weightedSample) Percentile(p float64) float64 {
+	return s.Percentiles([]float64{p})[0]
+}
+
+// Percentiles returns a slice of arbitrary percentiles of values at the time the copy was made,
+// interpolated like the go-metrics samples percentiles with every value counted by its weight.
+func (s *weightedSample) Percentiles(ps []float64) []float64 {
+	scores := make([]float64, len(ps))
+	if len(s.values) == 0 {
+		return scores
+	}
+	for i, p := range ps {
+		pos := p * float64(s.count+1)
+		if pos < 1.0 {
+			scores[i] = float64(s.Min())
+		} else if pos >= float64(s.count) {
+			scores[i] = float64(s.Max())
+		} else {
+			lower := s.valueAt(math.Floor(pos) - 1)
+			upper := s.valueAt(math.Floor(pos))
+			scores[i] = lower + (pos-math.Floor(pos))*(upper-lower)
+		}
+	}
+	return scores
+}
+
+// valueAt returns the value of the given 0 based rank
+func (s *weightedSample) valueAt(rank float64) float64 {
+	for _, v := range s.values {
+		if rank < v.weight {
+			return float64(v.value)
+		}
+		rank -= v.weight
+	}
+	return float64(s.Max())
+}
+
+// Size returns the number of values in the sample at the time the copy was made.
+func (s *weightedSample) Size() int { return len(s.values) }
+
+// StdDev returns the standard deviation of values at the time the copy was made.
+func (s *weightedSample) StdDev() float64 {
+	return math.Sqrt(s.Variance())
+}
+
+// Sum returns the estimated sum of the values recorded during the time window at the time the copy was made.
+func (s *weightedSample) Sum() int64 {
+	return int64(math.Round(s.sum()))
+}
+
+func (s *weightedSample) sum() float64 {
+	var sum float64
+	for _, v := range s.values {
+		sum += float64(v.value) * v.weight
+	}
+	return sum
+}
+
+// Values returns a copy of the values in the sample, sorted.
+func (s *weightedSample) Values() []int64 {
+	values := make([]int64, len(s.values))
+	for i, v := range s.values {
+		values[i] = v.value
+	}
+	return values
+}
+
+// Variance returns the variance of values at the time the copy was made.
+func (s *weightedSample) Variance() float64 {
+	if s.count == 0 {
+		return 0
+	}
+	m := s.Mean()
+	var sum float64
+	for _, v := range s.values {
+		d := float64(v.value) - m
+		sum += d * d * v.weight
+	}
+	return sum / float64(s.count)
+}
+
+// centroids returns the values of the sample with their weights as counts
+func (s *weightedSample) centroids() []histogram.Centroid {
+	centroids := make([]histogram.Centroid, len(s.values))
+	for i, v := range s.values {
+		centroids[i] = histogram.Centroid{Value: float64(v.value), Count: int(math.Max(1, math.Round(v.weight)))}
+	}
+	return centroids
+}
@@ -0,0 +1,102 @@
+package reporting
+
+import (
+	"testing"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlidingWindowSample(t *testing.T) {
+	clock := &testClock{now: time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)}
+	s := newSlidingWindowSample(clock.Now, time.Minute, 6, 100)
+
+	for i := 1; i <= 10; i++ {
+		s.Update(int64(i))
+	}
+	expected := metrics.NewSampleSnapshot(10, []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+	ps := []float64{0.1, 0.5, 0.75, 0.99}
+	assert.Equal(t, expected.Percentiles(ps), s.Percentiles(ps))
+	assert.Equal(t, expected.Mean(), s.Mean())
+	assert.Equal(t, expected.Variance(), s.Variance())
+	assert.Equal(t, int64(55), s.Sum())
+
+	clock.Add(30 * time.Second)
+	s.Update(100)
+	assert.Equal(t, int64(11), s.Count())
+	assert.Equal(t, int64(100), s.Max())
+
+	// the first values leave the window
+	clock.Add(40 * time.Second)
+	assert.Equal(t, int64(1), s.Count())
+	assert.Equal(t, []int64{100}, s.Values())
+
+	clock.Add(time.Minute)
+	assert.Equal(t, int64(0), s.Count())
+	assert.Equal(t, 0.0, s.Percentile(0.5))
+}
+
+func TestSlidingWindowSampleWeights(t *testing.T) {
+	clock := &testClock{now: time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)}
+	s := newSlidingWindowSample(clock.Now, time.Minute, 2, 10)
+
+	// 1000 values of 1 sampled in 10 values, and 10 values of 1000
+	for i := 0; i < 1000; i++ {
+		s.Update(1)
+	}
+	clock.Add(30 * time.Second)
+	for i := 0; i < 10; i++ {
+		s.Update(1000)
+	}
+
+	assert.Equal(t, int64(1010), s.Count())
+	assert.Equal(t, 20, s.Size())
+	assert.Equal(t, 1.0, s.Percentile(0.95))
+	assert.Equal(t, 1000.0, s.Percentile(0.999))
+	assert.Equal(t, int64(11000), s.Sum())
+
+	snapshot := s.Snapshot()
+	assert.Equal(t, int64(1010), snapshot.Count())
+	assert.Equal(t, []int64{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1000}, snapshot.Values())
+}
+
+func TestSlidingWindowSampleShortWindow(t *testing.T) {
+	for _, window := range []time.Duration{0, 3} {
+		s := NewSlidingWindowSample(window, 6, 10)
+		s.Update(1)
+		assert.NotPanics(t, func() { s.Snapshot() })
+	}
+}
+
+func TestSlidingWindowSampleEmptyReservoir(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+	s := newSlidingWindowSample(clock.Now, time.Minute, 6, 0)
+	s.Update(1)
+	s.Update(1)
+	assert.Equal(t, int64(2), s.Count())
+	assert.Equal(t, 1.0, s.Mean())
+	assert.Equal(t, int64(2), s.Sum())
+	assert.Equal(t, []int64{1}, s.Snapshot().Values())
+}
+
+func TestReportSlidingWindowSample(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(), CustomRegistry(metrics.NewRegistry()))
+
+	h := metrics.NewHistogram(NewSlidingWindowSample(time.Minute, 6, 100))
+	reporter.RegisterMetric("h", h, nil)
+	h.Update(5)
+	h.Update(7)
+	reporter.Report()
+
+	values := map[string]float64{}
+	for _, m := range sender.Metrics {
+		values[m.Name] = m.Value
+	}
+	assert.Equal(t, 2.0, values["h.count"])
+	assert.Equal(t, 5.0, values["h.min"])
+	assert.Equal(t, 7.0, values["h.max"])
+
+	reporter.Close()
+}
@@ -0,0 +1,448 @@
+package reporting
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/wavefronthq/wavefront-sdk-go/histogram"
+)
+
+// Default settings of the summaries
+var (
+	DefaultObjectives = map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}
+	DefaultMaxAge     = 10 * time.Minute
+	DefaultAgeBuckets = 5
+)
+
+// summaryBufferSize is the number of values buffered before they are merged in a quantile stream
+const summaryBufferSize = 500
+
+// Summary is a metrics.Histogram estimating targeted quantiles of its values with the CKMS algorithm
+// (see "Effective Computation of Biased Quantiles over Data Streams", Cormode et al.), like the
+// Prometheus summaries. Every objective maps a quantile to its allowed absolute error, so a few tail
+// quantiles are estimated accurately with far less memory than a sample.
+// The quantiles, min, max, mean and variance describe the values of the last max age, with the precision
+// of an age bucket, while the count and sum include all the values recorded since the summary was created.
+// The percentiles which are not objectives are estimated without guarantee.
+// Reported as a distribution, it sends the values recorded since the previous report.
+type Summary struct {
+	mutex      sync.Mutex
+	clock      func() time.Time
+	objectives []objective
+	streams    []*summaryStream // one per age bucket, the head stream holds the values of the last max age
+	interval   *summaryStream   // values recorded since the distribution was last reported
+	head       int
+	headExpiry time.Time
+	bucketAge  time.Duration
+	count      int64
+	sum        float64
+}
+
+type objective struct {
+	quantile float64
+	epsilon  float64
+}
+
+// NewSummary creates a Summary estimating the quantiles of the given objectives, which map the quantiles
+// to their allowed absolute errors, of the values recorded during the last max age, in the given number
+// of age buckets. The default settings are used for the zero values. The objectives whose quantile is not
+// between 0 and 1 excluded are ignored, the default objectives are used if none is left, and the errors are
+// clamped between 0 and 1.
+func NewSummary(objectives map[float64]float64, maxAge time.Duration, ageBuckets int) metrics.Histogram {
+	return newSummary(time.Now, objectives, maxAge, ageBuckets)
+}
+
+func newSummary(clock func() time.Time, objectives map[float64]float64, maxAge time.Duration, ageBuckets int) *Summary {
+	objectives = validObjectives(objectives)
+	if len(objectives) == 0 {
+		objectives = DefaultObjectives
+	}
+	if maxAge <= 0 {
+		maxAge = DefaultMaxAge
+	}
+	if ageBuckets <= 0 {
+		ageBuckets = DefaultAgeBuckets
+	}
+
+	s := &Summary{clock: clock, bucketAge: maxAge / time.Duration(ageBuckets)}
+	for q, e := range objectives {
+		s.objectives = append(s.objectives, objective{quantile: q, epsilon: e})
+	}
+	sort.Slice(s.objectives, func(i, j int) bool { return s.objectives[i].quantile < s.objectives[j].quantile })
+	for i := 0; i < ageBuckets; i++ {
+		s.streams = append(s.streams, newSummaryStream(s.objectives))
+	}
+	s.interval = newSummaryStream(s.objectives)
+	s.headExpiry = clock().Add(s.bucketAge)
+	return s
+}
+
+// validObjectives returns the objectives whose quantile is in (0, 1), with their error clamped to [0, 1],
+// as the other quantiles make the allowed errors infinite or negative
+func validObjectives(objectives map[float64]float64) map[float64]float64 {
+	res := make(map[float64]float64, len(objectives))
+	for q, e := range objectives {
+		if !(q > 0 && q < 1) {
+			continue
+		}
+		if !(e > 0) {
+			e = 0
+		}
+		res[q] = math.Min(e, 1)
+	}
+	return res
+}
+
+// rotate resets the expired head streams, must be called with s.mutex held
+func (s *Summary) rotate() {
+	now := s.clock()
+	for !now.Before(s.headExpiry) {
+		s.streams[s.head].reset()
+		s.head = (s.head + 1) % len(s.streams)
+		s.headExpiry = s.headExpiry.Add(s.bucketAge)
+	}
+}
+
+// Clear discards all the values of the summary.
+func (s *Summary) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, stream := range s.streams {
+		stream.reset()
+	}
+	s.interval.reset()
+	s.count = 0
+	s.sum = 0
+}
+
+// Count returns the number of values recorded since the summary was created.
+func (s *Summary) Count() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count
+}
+
+// Max returns the maximum value recorded during the last max age.
+func (s *Summary) Max() int64 {
+	return s.snapshot().Max()
+}
+
+// Mean returns the mean of the values recorded during the last max age.
+func (s *Summary) Mean() float64 {
+	return s.snapshot().Mean()
+}
+
+// Min returns the minimum value recorded during the last max age.
+func (s *Summary) Min() int64 {
+	return s.snapshot().Min()
+}
+
+// Percentile returns an arbitrary percentile of the values recorded during the last max age.
+func (s *Summary) Percentile(p float64) float64 {
+	return s.snapshot().Percentile(p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the values recorded during the last max age.
+func (s *Summary) Percentiles(ps []float64) []float64 {
+	return s.snapshot().Percentiles(ps)
+}
+
+// Sample returns a read-only metrics.Sample of the values recorded during the last max age.
+func (s *Summary) Sample() metrics.Sample {
+	return s.snapshot().Sample()
+}
+
+// Snapshot returns a read-only copy of the summary.
+func (s *Summary) Snapshot() metrics.Histogram {
+	return s.snapshot()
+}
+
+func (s *Summary) snapshot() *SummarySnapshot {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.rotate()
+	return &SummarySnapshot{stream: s.streams[s.head].copy(), count: s.count, sum: s.sum}
+}
+
+// StdDev returns the standard deviation of the values recorded during the last max age.
+func (s *Summary) StdDev() float64 {
+	return s.snapshot().StdDev()
+}
+
+// Sum returns the sum of the values recorded since the summary was created.
+func (s *Summary) Sum() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return int64(s.sum)
+}
+
+// Update records a value.
+func (s *Summary) Update(v int64) {
+	s.UpdateFloat64(float64(v))
+}
+
+// UpdateFloat64 records a value, without truncating it.
+func (s *Summary) UpdateFloat64(v float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.rotate()
+	for _, stream := range s.streams {
+		stream.insert(v)
+	}
+	s.interval.insert(v)
+	s.count++
+	s.sum += v
+}
+
+// Variance returns the variance of the values recorded during the last max age.
+func (s *Summary) Variance() float64 {
+	return s.snapshot().Variance()
+}
+
+// centroids returns the values recorded since the previous call, with the number of values they stand for
+func (s *Summary) centroids() []histogram.Centroid {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot := &SummarySnapshot{stream: s.interval.copy()}
+	s.interval.reset()
+	return snapshot.centroids()
+}
+
+// SummarySnapshot is a read-only copy of a Summary.
+type SummarySnapshot struct {
+	stream *summaryStream
+	count  int64
+	sum    float64
+}
+
+// Clear panics.
+func (*SummarySnapshot) Clear() {
+	panic("Clear called on a SummarySnapshot")
+}
+
+// Count returns the number of values recorded since the summary was created, at the time the snapshot was taken.
+func (s *SummarySnapshot) Count() int64 { return s.count }
+
+// Max returns the maximum value of the last max age at the time the snapshot was taken.
+func (s *SummarySnapshot) Max() int64 { return int64(s.stream.max) }
+
+// Mean returns the mean value of the last max age at the time the snapshot was taken.
+func (s *SummarySnapshot) Mean() float64 {
+	if s.stream.n == 0 {
+		return 0
+	}
+	return s.stream.sum / s.stream.n
+}
+
+// Min returns the minimum value of the last max age at the time the snapshot was taken.
+func (s *SummarySnapshot) Min() int64 { return int64(s.stream.min) }
+
+// Percentile returns an arbitrary percentile of the values of the last max age at the time the snapshot was taken.
+func (s *SummarySnapshot) Percentile(p float64) float64 {
+	return s.stream.query(p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the values of the last max age at the time the snapshot was taken.
+func (s *SummarySnapshot) Percentiles(ps []float64) []float64 {
+	scores := make([]float64, len(ps))
+	for i, p := range ps {
+		scores[i] = s.stream.query(p)
+	}
+	return scores
+}
+
+// Sample returns a read-only metrics.Sample with the values kept for the last max age,
+// each value repeated as many times as the number of values it stands for.
+func (s *SummarySnapshot) Sample() metrics.Sample {
+	var values []int64
+	for _, c := range s.centroids() {
+		for i := 0; i < c.Count; i++ {
+			values = append(values, int64(c.Value))
+		}
+	}
+	return metrics.NewSampleSnapshot(int64(s.stream.n), values)
+}
+
+// Snapshot returns the snapshot.
+func (s *SummarySnapshot) Snapshot() metrics.Histogram { return s }
+
+// StdDev returns the standard deviation of the values of the last max age at the time the snapshot was taken.
+func (s *SummarySnapshot) StdDev() float64 {
+	return math.Sqrt(s.Variance())
+}
+
+// Sum returns the sum of the values recorded since the summary was created, at the time the snapshot was taken.
+func (s *SummarySnapshot) Sum() int64 { return int64(s.sum) }
+
+// Update panics.
+func (*SummarySnapshot) Update(int64) {
+	panic("Update called on a SummarySnapshot")
+}
+
+// Variance returns the variance of the values of the last max age at the time the snapshot was taken.
+func (s *SummarySnapshot) Variance() float64 {
+	if s.stream.n == 0 {
+		return 0
+	}
+	m := s.Mean()
+	return math.Max(0, s.stream.squares/s.stream.n-m*m)
+}
+
+// centroids returns the values kept by the stream with the number of values they stand for
+func (s *SummarySnapshot) centroids() []histogram.Centroid {
+	centroids := make([]histogram.Centroid, len(s.stream.samples))
+	for i, sample := range s.stream.samples {
+		centroids[i] = histogram.Centroid{Value: sample.value, Count: int(sample.width)}
+	}
+	return centroids
+}
+
+// summaryStream estimates the targeted quantiles of a stream of values, ported from the
+// github.com/beorn7/perks/quantile implementation of the CKMS algorithm.
+type summaryStream struct {
+	objectives []objective
+	n          float64
+	samples    []summarySample // sorted by value
+	buffer     []float64
+	sum        float64
+	squares    float64
+	min        float64
+	max        float64
+}
+
+type summarySample struct {
+	value float64
+	width float64 // number of values the sample stands for
+	delta float64 // uncertainty of the rank of the sample
+}
+
+func newSummaryStream(objectives []objective) *summaryStream {
+	return &summaryStream{objectives: objectives, buffer: make([]float64, 0, summaryBufferSize)}
+}
+
+// invariant returns the error allowed for the given rank
+func (s *summaryStream) invariant(r float64) float64 {
+	m := math.MaxFloat64
+	for _, o := range s.objectives {
+		var f float64
+		if o.quantile*s.n <= r {
+			f = (2 * o.epsilon * r) / o.quantile
+		} else {
+			f = (2 * o.epsilon * (s.n - r)) / (1 - o.quantile)
+		}
+		if f < m {
+			m = f
+		}
+	}
+	return m
+}
+
+func (s *summaryStream) insert(v float64) {
+	if s.n == 0 && len(s.buffer) == 0 {
+		s.min, s.max = v, v
+	}
+	s.min = math.Min(s.min, v)
+	s.max = math.Max(s.max, v)
+	s.sum += v
+	s.squares += v * v
+	s.buffer = append(s.buffer, v)
+	if len(s.buffer) == summaryBufferSize {
+		s.flush()
+	}
+}
+
+// flush merges the buffered values in the samples
+func (s *summaryStream) flush() {
+	if len(s.buffer) == 0 {
+		return
+	}
+	sort.Float64s(s.buffer)
+	var r float64
+	i := 0
+	for _, v := range s.buffer {
+		inserted := false
+		for ; i < len(s.samples); i++ {
+			c := s.samples[i]
+			if c.value > v {
+				s.samples = append(s.samples, summarySample{})
+				copy(s.samples[i+1:], s.samples[i:])
+				s.samples[i] = summarySample{value: v, width: 1, delta: math.Max(0, math.Floor(s.invariant(r))-1)}
+				i++
+				inserted = true
+				break
+			}
+			r += c.width
+		}
+		if !inserted {
+			s.samples = append(s.samples, summarySample{value: v, width: 1})
+			i++
+		}
+		s.n++
+		r++
+	}
+	s.buffer = s.buffer[:0]
+	s.compress()
+}
+
+// compress merges the samples whose ranks are known within the allowed error
+func (s *summaryStream) compress() {
+	if len(s.samples) < 2 {
+		return
+	}
+	x := s.samples[len(s.samples)-1]
+	xi := len(s.samples) - 1
+	r := s.n - 1 - x.width
+	for i := len(s.samples) - 2; i >= 0; i-- {
+		c := s.samples[i]
+		if c.width+x.width+x.delta <= s.invariant(r) {
+			x.width += c.width
+			s.samples[xi] = x
+			copy(s.samples[i:], s.samples[i+1:])
+			s.samples = s.samples[:len(s.samples)-1]
+			xi--
+		} else {
+			x = c
+			xi = i
+		}
+		r -= c.width
+	}
+}
+
+// query returns the estimated value of the given quantile
+func (s *summaryStream) query(q float64) float64 {
+	s.flush()
+	if len(s.samples) == 0 {
+		return 0
+	}
+	t := math.Ceil(q * s.n)
+	t += math.Ceil(s.invariant(t) / 2)
+	p := s.samples[0]
+	var r float64
+	for _, c := range s.samples[1:] {
+		r += p.width
+		if r+c.width+c.delta > t {
+			return p.value
+		}
+		p = c
+	}
+	return p.value
+}
+
+func (s *summaryStream) reset() {
+	s.n = 0
+	s.samples = s.samples[:0]
+	s.buffer = s.buffer[:0]
+	s.sum, s.squares, s.min, s.max = 0, 0, 0, 0
+}
+
+// copy returns a copy of the stream with its buffered values merged
+func (s *summaryStream) copy() *summaryStream {
+	s.flush()
+	c := *s
+	c.samples = append([]summarySample{}, s.samples...)
+	c.buffer = nil
+	return &c
+}
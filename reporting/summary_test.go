@@ -0,0 +1,112 @@
+package reporting
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/wavefronthq/wavefront-sdk-go/histogram"
+)
+
+func TestSummary(t *testing.T) {
+	objectives := map[float64]float64{0.5: 0.01, 0.99: 0.001, 0.999: 0.0001}
+	s := NewSummary(objectives, time.Hour, 1)
+	for _, v := range rand.Perm(100000) {
+		s.Update(int64(v + 1))
+	}
+
+	assert.Equal(t, int64(100000), s.Count())
+	assert.Equal(t, int64(5000050000), s.Sum())
+	assert.Equal(t, int64(1), s.Min())
+	assert.Equal(t, int64(100000), s.Max())
+	assert.Equal(t, 50000.5, s.Mean())
+	for q, e := range objectives {
+		assert.InDelta(t, q*100000, s.Percentile(q), e*100000, "quantile %v", q)
+	}
+	assert.InEpsilon(t, math.Sqrt((100000*100000-1)/12.0), s.StdDev(), 1e-6)
+	assert.Equal(t, 100000, len(s.Sample().Values()))
+	assert.True(t, len(s.(*Summary).centroids()) < 5000)
+
+	s.Clear()
+	assert.Equal(t, int64(0), s.Count())
+	assert.Equal(t, 0.0, s.Percentile(0.5))
+}
+
+func TestSummaryInvalidObjectives(t *testing.T) {
+	s := newSummary(time.Now, map[float64]float64{0: 0.1, 1: 0.1, 1.5: 0.1, -0.5: 0.1, math.NaN(): 0.1}, 0, 0)
+	assert.Equal(t, len(DefaultObjectives), len(s.objectives))
+
+	s = newSummary(time.Now, map[float64]float64{1: 0.1, 0.5: -0.05, 0.9: 2}, 0, 0)
+	assert.Equal(t, []objective{{quantile: 0.5, epsilon: 0}, {quantile: 0.9, epsilon: 1}}, s.objectives)
+	for i := 1; i <= 1000; i++ {
+		s.Update(int64(i))
+	}
+	assert.False(t, math.IsNaN(s.Percentile(0.5)))
+	assert.InDelta(t, 500, s.Percentile(0.5), 1)
+}
+
+func TestSummaryAgeBuckets(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+	s := newSummary(clock.Now, nil, 10*time.Minute, 5)
+	s.Update(1000)
+	clock.Add(5 * time.Minute)
+	s.Update(1)
+	s.Update(2)
+	assert.Equal(t, int64(1000), s.Max())
+
+	// the first value is left out of the head bucket after the max age
+	clock.Add(5 * time.Minute)
+	assert.Equal(t, int64(2), s.Max())
+	assert.Equal(t, 1.5, s.Mean())
+	assert.Equal(t, int64(3), s.Count())
+
+	clock.Add(time.Hour)
+	assert.Equal(t, 0.0, s.Percentile(0.99))
+	assert.Equal(t, int64(1003), s.Sum())
+}
+
+func TestReportSummary(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(), CustomRegistry(metrics.NewRegistry()))
+
+	s := NewSummary(map[float64]float64{0.99: 0.001}, 0, 0)
+	reporter.RegisterMetric("latency", s, nil)
+	for i := int64(1); i <= 1000; i++ {
+		s.Update(i)
+	}
+	reporter.Report()
+
+	values := map[string]float64{}
+	for _, m := range sender.Metrics {
+		values[m.Name] = m.Value
+	}
+	assert.InDelta(t, 990.0, values["latency.99-percentile"], 1)
+	assert.Equal(t, 1000.0, values["latency.count"])
+	assert.Equal(t, 1000.0, values["latency.max"])
+
+	reporter.Close()
+}
+
+func TestReportSummaryDistribution(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(), CustomRegistry(metrics.NewRegistry())).(ExtendedMetricsReporter)
+
+	s := NewSummary(nil, 0, 0)
+	reporter.RegisterMetricWithOptions("latency", s, nil, AsDistribution())
+	s.Update(5)
+	reporter.Report()
+	reporter.Report()
+	s.Update(7)
+	reporter.Report()
+
+	// every value is sent once
+	if assert.Equal(t, 2, len(sender.Distributions)) {
+		assert.Equal(t, []histogram.Centroid{{Value: 5, Count: 1}}, sender.Distributions[0].Centroids)
+		assert.Equal(t, []histogram.Centroid{{Value: 7, Count: 1}}, sender.Distributions[1].Centroids)
+	}
+
+	reporter.Close()
+}
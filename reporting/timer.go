@@ -0,0 +1,206 @@
+package reporting
+
+import (
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/wavefronthq/wavefront-sdk-go/histogram"
+)
+
+// Timer is a metrics.Timer recording its durations in a Wavefront Histogram, so they are
+// reported as distributions, while its count and rates are reported as regular metrics.
+type Timer struct {
+	histogram Histogram
+	meter     metrics.Meter
+}
+
+// NewTimer create a new Timer backed by a Wavefront Histogram created with the given options
+func NewTimer(options ...histogram.Option) metrics.Timer {
+	return Timer{histogram: NewHistogram(options...).(Histogram), meter: metrics.NewMeter()}
+}
+
+// Count returns the number of events recorded.
+func (t Timer) Count() int64 {
+	return t.meter.Count()
+}
+
+// Max returns the maximum value in the sample.
+func (t Timer) Max() int64 {
+	return t.histogram.Max()
+}
+
+// Mean returns the mean of the values in the sample.
+func (t Timer) Mean() float64 {
+	return t.histogram.Mean()
+}
+
+// Min returns the minimum value in the sample.
+func (t Timer) Min() int64 {
+	return t.histogram.Min()
+}
+
+// Percentile returns an arbitrary percentile of the values in the sample.
+func (t Timer) Percentile(p float64) float64 {
+	return t.histogram.Percentile(p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the values in the sample.
+func (t Timer) Percentiles(ps []float64) []float64 {
+	return t.histogram.Percentiles(ps)
+}
+
+// Rate1 returns the one-minute moving average rate of events per second.
+func (t Timer) Rate1() float64 {
+	return t.meter.Rate1()
+}
+
+// Rate5 returns the five-minute moving average rate of events per second.
+func (t Timer) Rate5() float64 {
+	return t.meter.Rate5()
+}
+
+// Rate15 returns the fifteen-minute moving average rate of events per second.
+func (t Timer) Rate15() float64 {
+	return t.meter.Rate15()
+}
+
+// RateMean returns the meter's mean rate of events per second.
+func (t Timer) RateMean() float64 {
+	return t.meter.RateMean()
+}
+
+// Snapshot returns a read-only copy of the timer.
+func (t Timer) Snapshot() metrics.Timer {
+	return TimerSnapshot{histogram: t.histogram.Snapshot().(HistogramSnapshot), meter: t.meter.Snapshot()}
+}
+
+// StdDev returns the standard deviation of the values in the sample.
+func (t Timer) StdDev() float64 {
+	return t.histogram.StdDev()
+}
+
+// Stop stops the meter.
+func (t Timer) Stop() {
+	t.meter.Stop()
+}
+
+// Sum returns the sum in the sample.
+func (t Timer) Sum() int64 {
+	return t.histogram.Sum()
+}
+
+// Time record the duration of the execution of the given function.
+func (t Timer) Time(f func()) {
+	ts := time.Now()
+	f()
+	t.UpdateSince(ts)
+}
+
+// Update the duration of an event.
+func (t Timer) Update(d time.Duration) {
+	t.histogram.Update(int64(d))
+	t.meter.Mark(1)
+}
+
+// UpdateSince update the duration of an event that started at a time and ends now.
+func (t Timer) UpdateSince(ts time.Time) {
+	t.Update(time.Since(ts))
+}
+
+// Variance returns the variance of the values in the sample.
+func (t Timer) Variance() float64 {
+	return t.histogram.Variance()
+}
+
+// Distributions returns all the durations on completed time slices, and clear them
+func (t Timer) Distributions() []histogram.Distribution {
+	return t.histogram.Distributions()
+}
+
+// DistributionsByGranularity returns all the durations on completed time slices of every granularity, and clear them
+func (t Timer) DistributionsByGranularity() map[histogram.Granularity][]histogram.Distribution {
+	return t.histogram.DistributionsByGranularity()
+}
+
+// Flush completes the current time slices of the timer histogram, so their durations are
+// returned by the next call to Distributions.
+// It returns ErrCustomTimeSupplier for the timers created with a histogram.TimeSupplier option.
+func (t Timer) Flush() error {
+	return t.histogram.Flush()
+}
+
+// Granularity value, the finest one if the timer histogram has several granularities
+func (t Timer) Granularity() histogram.Granularity {
+	return t.histogram.Granularity()
+}
+
+// Granularities returns all the granularities of the timer histogram, the finest first
+func (t Timer) Granularities() []histogram.Granularity {
+	return t.histogram.Granularities()
+}
+
+// TimerSnapshot is a read-only copy of a Timer.
+type TimerSnapshot struct {
+	histogram HistogramSnapshot
+	meter     metrics.Meter
+}
+
+// Count returns the number of events recorded at the time the snapshot was taken.
+func (t TimerSnapshot) Count() int64 { return t.meter.Count() }
+
+// Max returns the maximum value at the time the snapshot was taken.
+func (t TimerSnapshot) Max() int64 { return t.histogram.Max() }
+
+// Mean returns the mean value at the time the snapshot was taken.
+func (t TimerSnapshot) Mean() float64 { return t.histogram.Mean() }
+
+// Min returns the minimum value at the time the snapshot was taken.
+func (t TimerSnapshot) Min() int64 { return t.histogram.Min() }
+
+// Percentile returns an arbitrary percentile of sampled values at the time the snapshot was taken.
+func (t TimerSnapshot) Percentile(p float64) float64 { return t.histogram.Percentile(p) }
+
+// Percentiles returns a slice of arbitrary percentiles of sampled values at the time the snapshot was taken.
+func (t TimerSnapshot) Percentiles(ps []float64) []float64 { return t.histogram.Percentiles(ps) }
+
+// Rate1 returns the one-minute moving average rate of events per second at the time the snapshot was taken.
+func (t TimerSnapshot) Rate1() float64 { return t.meter.Rate1() }
+
+// Rate5 returns the five-minute moving average rate of events per second at the time the snapshot was taken.
+func (t TimerSnapshot) Rate5() float64 { return t.meter.Rate5() }
+
+// Rate15 returns the fifteen-minute moving average rate of events per second at the time the snapshot was taken.
+func (t TimerSnapshot) Rate15() float64 { return t.meter.Rate15() }
+
+// RateMean returns the meter's mean rate of events per second at the time the snapshot was taken.
+func (t TimerSnapshot) RateMean() float64 { return t.meter.RateMean() }
+
+// Snapshot returns the snapshot.
+func (t TimerSnapshot) Snapshot() metrics.Timer { return t }
+
+// StdDev returns the standard deviation of the values at the time the snapshot was taken.
+func (t TimerSnapshot) StdDev() float64 { return t.histogram.StdDev() }
+
+// Stop is a no-op.
+func (t TimerSnapshot) Stop() {}
+
+// Sum returns the sum at the time the snapshot was taken.
+func (t TimerSnapshot) Sum() int64 { return t.histogram.Sum() }
+
+// Time panics.
+func (TimerSnapshot) Time(func()) {
+	panic("Time called on a TimerSnapshot")
+}
+
+// Update panics.
+func (TimerSnapshot) Update(time.Duration) {
+	panic("Update called on a TimerSnapshot")
+}
+
+// UpdateSince panics.
+func (TimerSnapshot) UpdateSince(time.Time) {
+	panic("UpdateSince called on a TimerSnapshot")
+}
+
+// Variance returns the variance of the values at the time the snapshot was taken.
+func (t TimerSnapshot) Variance() float64 { return t.histogram.Variance() }
@@ -0,0 +1,59 @@
+package reporting
+
+import (
+	"testing"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/wavefronthq/wavefront-sdk-go/histogram"
+)
+
+func TestWFTimer(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+	timer := NewTimer(histogram.TimeSupplier(clock.Now))
+	defer timer.Stop()
+
+	timer.Update(time.Second)
+	timer.Update(3 * time.Second)
+	timer.Time(func() {})
+	clock.Add(time.Minute)
+
+	assert.Equal(t, int64(3), timer.Count())
+	assert.Equal(t, int64(3*time.Second), timer.Max())
+	assert.InDelta(t, int64(4*time.Second), timer.Sum(), float64(time.Millisecond))
+	assert.True(t, timer.Rate1() >= 0)
+
+	snapshot := timer.Snapshot()
+	assert.Equal(t, int64(3), snapshot.Count())
+	assert.Equal(t, timer.Max(), snapshot.Max())
+	assert.Equal(t, timer.Percentiles([]float64{0.5}), snapshot.Percentiles([]float64{0.5}))
+	assert.Panics(t, func() { snapshot.Update(time.Second) })
+	assert.Equal(t, TypeWavefrontTimer, TypeOf(timer))
+}
+
+func TestReportWFTimer(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(), CustomRegistry(metrics.NewRegistry()))
+
+	clock := &testClock{now: time.Now()}
+	timer := NewTimer(histogram.TimeSupplier(clock.Now))
+	reporter.RegisterMetric("latency", timer, map[string]string{"route": "/"})
+
+	timer.Update(2 * time.Second)
+	clock.Add(time.Minute)
+	reporter.Report()
+
+	assert.Equal(t, 1, len(sender.Distributions))
+	assert.Equal(t, "latency", sender.Distributions[0].Name)
+	assert.Equal(t, []histogram.Centroid{{Value: float64(2 * time.Second), Count: 1}}, sender.Distributions[0].Centroids)
+
+	names := map[string]bool{}
+	for _, m := range sender.Metrics {
+		names[m.Name] = true
+	}
+	assert.Equal(t, map[string]bool{"latency.count": true, "latency.one-minute": true, "latency.five-minute": true,
+		"latency.fifteen-minute": true, "latency.mean-rate": true}, names)
+
+	reporter.Close()
+}
@@ -0,0 +1,225 @@
+package reporting
+
+import (
+	"container/heap"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Tags of the gauges of a TopK
+const (
+	TopKKeyTag   = "key"
+	TopKRankTag  = "rank"
+	TopKOtherKey = "other" // value of the key tag of the gauge counting the keys out of the top K, which has no rank tag
+)
+
+// TopK counts the most frequent keys, like the customers or endpoints generating the most traffic,
+// with the space-saving algorithm (see "Efficient Computation of Frequent and Top-k Elements in Data Streams",
+// Metwally et al.): it keeps a fixed number of counters, and a new key takes over the counter of the
+// least frequent key, so the counts of the keys are overestimated by at most the count of the key they replaced.
+// It is reported as a gauge per key of the top K, tagged with the key ('key' tag) and its rank from 1
+// ('rank' tag), and a gauge tagged 'key=other' counting all the other keys. After every report, the counts
+// are reset, or multiplied by the decay factor so the top K reflects the recent intervals, in which case the
+// counters decayed below 1 are dropped.
+// The go-metrics registries ignore this type, it must be registered through
+// the WavefrontMetricsReporter registration methods.
+type TopK struct {
+	mutex    sync.Mutex
+	k        int
+	capacity int
+	decay    float64
+	counters map[string]*topKCounter
+	heap     topKHeap // the counters, the least frequent first
+	total    float64  // sum of the counts of all the keys, including the keys which lost their counter
+	updates  int64
+}
+
+// TopKEntry is the count of a key of a TopK
+type TopKEntry struct {
+	Key   string
+	Count float64
+	Error float64 // maximal overestimation of the count
+}
+
+type topKCounter struct {
+	TopKEntry
+	index int // position in the heap
+}
+
+// NewTopK creates a TopK reporting the k most frequent keys, at least 1, out of the given number of counters,
+// which is 10 times k when lower than k; more counters make the counts more accurate.
+// The counts are multiplied by the decay factor after every report, a zero factor resets them.
+// The decay factor is clamped between 0 and 1, so the counts never grow, a NaN factor resets them.
+func NewTopK(k, capacity int, decay float64) *TopK {
+	if k < 1 {
+		k = 1
+	}
+	if capacity < k {
+		capacity = 10 * k
+	}
+	if !(decay > 0) {
+		decay = 0
+	}
+	if decay > 1 {
+		decay = 1
+	}
+	return &TopK{k: k, capacity: capacity, decay: decay, counters: make(map[string]*topKCounter)}
+}
+
+// Inc adds n, which is expected to be positive, to the count of the key
+func (t *TopK) Inc(key string, n int64) {
+	t.Add(key, float64(n))
+}
+
+// Add adds n, which is expected to be positive, to the count of the key
+func (t *TopK) Add(key string, n float64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.updates++
+	t.total += n
+	if c, ok := t.counters[key]; ok {
+		c.Count += n
+		heap.Fix(&t.heap, c.index)
+		return
+	}
+	if len(t.heap) < t.capacity {
+		c := &topKCounter{TopKEntry: TopKEntry{Key: key, Count: n}}
+		heap.Push(&t.heap, c)
+		t.counters[key] = c
+		return
+	}
+	// the least frequent key gives its counter to the new key
+	c := t.heap[0]
+	delete(t.counters, c.Key)
+	c.TopKEntry = TopKEntry{Key: key, Count: c.Count + n, Error: c.Count}
+	t.counters[key] = c
+	heap.Fix(&t.heap, 0)
+}
+
+// Top returns the k most frequent keys, the most frequent first
+func (t *TopK) Top() []TopKEntry {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.top()
+}
+
+func (t *TopK) top() []TopKEntry {
+	entries := make([]TopKEntry, 0, len(t.heap))
+	for _, c := range t.heap {
+		entries = append(entries, c.TopKEntry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	if len(entries) > t.k {
+		entries = entries[:t.k]
+	}
+	return entries
+}
+
+// Total returns the sum of the counts of all the keys
+func (t *TopK) Total() float64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.total
+}
+
+// Clear resets the counts of all the keys
+func (t *TopK) Clear() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.clear()
+}
+
+func (t *TopK) clear() {
+	t.counters = make(map[string]*topKCounter)
+	t.heap = t.heap[:0]
+	t.total = 0
+}
+
+// swap returns the top k keys and the count of the other keys, then resets or decays the counts
+func (t *TopK) swap() ([]TopKEntry, float64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	top := t.top()
+	other := t.total
+	for _, e := range top {
+		other -= e.Count
+	}
+
+	if t.decay <= 0 {
+		t.clear()
+		return top, other
+	}
+	kept := t.heap[:0]
+	for _, c := range t.heap {
+		c.Count *= t.decay
+		c.Error *= t.decay
+		if c.Count < 1 {
+			delete(t.counters, c.Key)
+			continue
+		}
+		kept = append(kept, c)
+	}
+	t.heap = kept
+	heap.Init(&t.heap)
+	t.total *= t.decay
+	return top, other
+}
+
+// updated returns the number of updates of the counts, to detect idle series
+func (t *TopK) updated() int64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.updates
+}
+
+type topKHeap []*topKCounter
+
+func (h topKHeap) Len() int           { return len(h) }
+func (h topKHeap) Less(i, j int) bool { return h[i].Count < h[j].Count }
+func (h topKHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *topKHeap) Push(x interface{}) {
+	c := x.(*topKCounter)
+	c.index = len(*h)
+	*h = append(*h, c)
+}
+
+func (h *topKHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+func (r *reporter) reportTopK(name string, t *TopK, tags map[string]string) {
+	top, other := t.swap()
+	if len(top) == 0 {
+		return
+	}
+	send := func(value float64, extra map[string]string) {
+		keyTags := make(map[string]string, len(tags)+len(extra))
+		for k, v := range tags {
+			keyTags[k] = v
+		}
+		for k, v := range extra {
+			keyTags[k] = v
+		}
+		r.errors <- r.sender.SendMetric(r.prepareName(name, "value"), value, 0, r.source, keyTags)
+	}
+	for i, e := range top {
+		send(e.Count, map[string]string{TopKKeyTag: e.Key, TopKRankTag: strconv.Itoa(i + 1)})
+	}
+	send(other, map[string]string{TopKKeyTag: TopKOtherKey})
+}
@@ -0,0 +1,105 @@
+package reporting
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopK(t *testing.T) {
+	top := NewTopK(2, 0, 0)
+	for i := 0; i < 100; i++ {
+		top.Inc("a", 3)
+		top.Inc("b", 2)
+		top.Inc(fmt.Sprintf("rare-%d", i), 1)
+	}
+
+	entries := top.Top()
+	if assert.Equal(t, 2, len(entries)) {
+		assert.Equal(t, "a", entries[0].Key)
+		assert.Equal(t, "b", entries[1].Key)
+		// the counts are overestimated by at most the count of the evicted keys
+		assert.InDelta(t, 300, entries[0].Count, entries[0].Error)
+		assert.InDelta(t, 200, entries[1].Count, entries[1].Error)
+	}
+	assert.Equal(t, 600.0, top.Total())
+
+	top.Clear()
+	assert.Empty(t, top.Top())
+	assert.Equal(t, 0.0, top.Total())
+}
+
+func TestTopKEviction(t *testing.T) {
+	top := NewTopK(1, 2, 0)
+	top.Inc("a", 5)
+	top.Inc("b", 2)
+	top.Inc("c", 1)
+
+	// c takes over the counter of b
+	assert.Equal(t, []TopKEntry{{Key: "a", Count: 5}}, top.Top())
+	top.k = 2
+	assert.Equal(t, []TopKEntry{{Key: "a", Count: 5}, {Key: "c", Count: 3, Error: 2}}, top.Top())
+}
+
+func TestTopKMinimalSize(t *testing.T) {
+	top := NewTopK(0, 0, 0)
+	top.Inc("a", 1)
+	top.Inc("b", 2)
+	assert.Equal(t, []TopKEntry{{Key: "b", Count: 2}}, top.Top())
+	assert.Equal(t, 3.0, top.Total())
+}
+
+func TestTopKDecay(t *testing.T) {
+	top := NewTopK(2, 0, 0.5)
+	top.Inc("a", 10)
+	top.Inc("b", 1)
+	entries, other := top.swap()
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, 0.0, other)
+
+	// b decayed below 1 is dropped
+	assert.Equal(t, []TopKEntry{{Key: "a", Count: 5}}, top.Top())
+	assert.Equal(t, 5.5, top.Total())
+}
+
+func TestTopKDecayClamped(t *testing.T) {
+	assert.Equal(t, 0.0, NewTopK(1, 0, -0.5).decay)
+	assert.Equal(t, 0.0, NewTopK(1, 0, math.NaN()).decay)
+
+	top := NewTopK(1, 0, 2)
+	assert.Equal(t, 1.0, top.decay)
+	top.Inc("a", 10)
+	top.swap()
+	assert.Equal(t, []TopKEntry{{Key: "a", Count: 10}}, top.Top())
+}
+
+func TestReportTopK(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(), CustomRegistry(metrics.NewRegistry()))
+
+	top := NewTopK(2, 0, 0)
+	tags := map[string]string{"service": "api"}
+	assert.NoError(t, reporter.RegisterMetric("requests", top, tags))
+	assert.Equal(t, TypeTopK, TypeOf(reporter.GetMetric("requests", tags)))
+	top.Inc("alice", 5)
+	top.Inc("bob", 3)
+	top.Inc("carol", 1)
+	top.Inc("dave", 1)
+	reporter.Report()
+
+	assert.Equal(t, []MockMetirc{
+		{Name: "requests.value", Value: 5, Tags: map[string]string{"service": "api", TopKKeyTag: "alice", TopKRankTag: "1"}},
+		{Name: "requests.value", Value: 3, Tags: map[string]string{"service": "api", TopKKeyTag: "bob", TopKRankTag: "2"}},
+		{Name: "requests.value", Value: 2, Tags: map[string]string{"service": "api", TopKKeyTag: TopKOtherKey}},
+	}, sender.Metrics)
+
+	// the counts are reset after every report
+	reporter.Report()
+	assert.Equal(t, 3, len(sender.Metrics))
+	assert.Equal(t, 0.0, top.Total())
+
+	reporter.Close()
+}
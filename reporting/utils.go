@@ -2,6 +2,7 @@ package reporting
 
 import (
 	"net/url"
+	"path"
 	"sort"
 	"strings"
 )
@@ -53,6 +54,12 @@ func DecodeKey(key string) (string, map[string]string) {
 	return name, tagsMap
 }
 
+// matchName reports whether the metric name matches the shell pattern (see path.Match)
+func matchName(pattern, name string) bool {
+	matched, err := path.Match(pattern, name)
+	return err == nil && matched
+}
+
 func hostTagString(hostTags map[string]string) string {
 	htStr := ""
 	for k, v := range hostTags {
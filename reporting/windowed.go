@@ -0,0 +1,318 @@
+package reporting
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// WindowedHistogram is a metrics.Histogram whose statistics only describe the values recorded
+// since the previous reporting cycle. The reporter swaps its histogram for a new one on every
+// reporting cycle, so the values recorded while it is reported are kept for the next cycle.
+// Count returns the number of values recorded since the histogram was created.
+type WindowedHistogram struct {
+	w *windowedHistogram
+}
+
+type windowedHistogram struct {
+	mux          sync.RWMutex
+	newHistogram func() metrics.Histogram
+	current      metrics.Histogram
+	count        int64
+}
+
+// NewWindowedHistogram creates a WindowedHistogram recording the values of every reporting cycle
+// in a histogram created by the given function, or in a histogram with an exponentially-decaying
+// sample, like the go-metrics timers, if the function is nil.
+func NewWindowedHistogram(newHistogram func() metrics.Histogram) metrics.Histogram {
+	if newHistogram == nil {
+		newHistogram = func() metrics.Histogram {
+			return metrics.NewHistogram(metrics.NewExpDecaySample(1028, 0.015))
+		}
+	}
+	return WindowedHistogram{w: &windowedHistogram{newHistogram: newHistogram, current: newHistogram()}}
+}
+
+func (h WindowedHistogram) window() metrics.Histogram {
+	h.w.mux.RLock()
+	defer h.w.mux.RUnlock()
+	return h.w.current
+}
+
+// swap replaces the histogram of the current reporting cycle and returns a snapshot of the replaced one
+func (h WindowedHistogram) swap() metrics.Histogram {
+	h.w.mux.Lock()
+	previous := h.w.current
+	h.w.current = h.w.newHistogram()
+	h.w.mux.Unlock()
+	return windowSnapshot{Histogram: previous.Snapshot(), count: h.Count()}
+}
+
+// Clear discards the values of the current reporting cycle and resets the count.
+func (h WindowedHistogram) Clear() {
+	h.w.mux.Lock()
+	defer h.w.mux.Unlock()
+	h.w.current = h.w.newHistogram()
+	atomic.StoreInt64(&h.w.count, 0)
+}
+
+// Count returns the number of values recorded since the histogram was created.
+func (h WindowedHistogram) Count() int64 {
+	return atomic.LoadInt64(&h.w.count)
+}
+
+// Max returns the maximum value recorded during the current reporting cycle.
+func (h WindowedHistogram) Max() int64 {
+	return h.window().Max()
+}
+
+// Mean returns the mean of the values recorded during the current reporting cycle.
+func (h WindowedHistogram) Mean() float64 {
+	return h.window().Mean()
+}
+
+// Min returns the minimum value recorded during the current reporting cycle.
+func (h WindowedHistogram) Min() int64 {
+	return h.window().Min()
+}
+
+// Percentile returns an arbitrary percentile of the values recorded during the current reporting cycle.
+func (h WindowedHistogram) Percentile(p float64) float64 {
+	return h.window().Percentile(p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the values recorded during the current reporting cycle.
+func (h WindowedHistogram) Percentiles(ps []float64) []float64 {
+	return h.window().Percentiles(ps)
+}
+
+// Sample returns the sample of the current reporting cycle.
+func (h WindowedHistogram) Sample() metrics.Sample {
+	return h.window().Sample()
+}
+
+// Snapshot returns a read-only copy of the histogram of the current reporting cycle.
+func (h WindowedHistogram) Snapshot() metrics.Histogram {
+	return windowSnapshot{Histogram: h.window().Snapshot(), count: h.Count()}
+}
+
+// StdDev returns the standard deviation of the values recorded during the current reporting cycle.
+func (h WindowedHistogram) StdDev() float64 {
+	return h.window().StdDev()
+}
+
+// Sum returns the sum of the values recorded during the current reporting cycle.
+func (h WindowedHistogram) Sum() int64 {
+	return h.window().Sum()
+}
+
+// Update records a value.
+func (h WindowedHistogram) Update(v int64) {
+	// held during the update so the value is not recorded in a histogram being swapped
+	h.w.mux.RLock()
+	defer h.w.mux.RUnlock()
+	h.w.current.Update(v)
+	atomic.AddInt64(&h.w.count, 1)
+}
+
+// Variance returns the variance of the values recorded during the current reporting cycle.
+func (h WindowedHistogram) Variance() float64 {
+	return h.window().Variance()
+}
+
+// windowSnapshot is a snapshot of the histogram of a reporting cycle, with the count of the WindowedHistogram
+type windowSnapshot struct {
+	metrics.Histogram
+	count int64
+}
+
+// Count returns the number of values recorded since the WindowedHistogram was created.
+func (s windowSnapshot) Count() int64 { return s.count }
+
+// Snapshot returns the snapshot.
+func (s windowSnapshot) Snapshot() metrics.Histogram { return s }
+
+// WindowedTimer is a metrics.Timer whose durations statistics only describe the durations recorded
+// since the previous reporting cycle, like a WindowedHistogram. Its count and rates are not reset.
+type WindowedTimer struct {
+	histogram WindowedHistogram
+	meter     metrics.Meter
+}
+
+// NewWindowedTimer creates a WindowedTimer recording the durations of every reporting cycle in a histogram
+// created by the given function, or in a histogram with an exponentially-decaying sample if the function is nil.
+func NewWindowedTimer(newHistogram func() metrics.Histogram) metrics.Timer {
+	return WindowedTimer{histogram: NewWindowedHistogram(newHistogram).(WindowedHistogram), meter: metrics.NewMeter()}
+}
+
+// swap replaces the histogram of the current reporting cycle and returns a snapshot of the timer with the replaced one
+func (t WindowedTimer) swap() metrics.Timer {
+	return t.snapshot(t.histogram.swap())
+}
+
+func (t WindowedTimer) snapshot(h metrics.Histogram) metrics.Timer {
+	return windowedTimerSnapshot{histogram: h, meter: t.meter.Snapshot()}
+}
+
+// Count returns the number of events recorded since the timer was created.
+func (t WindowedTimer) Count() int64 {
+	return t.meter.Count()
+}
+
+// Max returns the maximum duration recorded during the current reporting cycle.
+func (t WindowedTimer) Max() int64 {
+	return t.histogram.Max()
+}
+
+// Mean returns the mean of the durations recorded during the current reporting cycle.
+func (t WindowedTimer) Mean() float64 {
+	return t.histogram.Mean()
+}
+
+// Min returns the minimum duration recorded during the current reporting cycle.
+func (t WindowedTimer) Min() int64 {
+	return t.histogram.Min()
+}
+
+// Percentile returns an arbitrary percentile of the durations recorded during the current reporting cycle.
+func (t WindowedTimer) Percentile(p float64) float64 {
+	return t.histogram.Percentile(p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the durations recorded during the current reporting cycle.
+func (t WindowedTimer) Percentiles(ps []float64) []float64 {
+	return t.histogram.Percentiles(ps)
+}
+
+// Rate1 returns the one-minute moving average rate of events per second.
+func (t WindowedTimer) Rate1() float64 {
+	return t.meter.Rate1()
+}
+
+// Rate5 returns the five-minute moving average rate of events per second.
+func (t WindowedTimer) Rate5() float64 {
+	return t.meter.Rate5()
+}
+
+// Rate15 returns the fifteen-minute moving average rate of events per second.
+func (t WindowedTimer) Rate15() float64 {
+	return t.meter.Rate15()
+}
+
+// RateMean returns the meter's mean rate of events per second.
+func (t WindowedTimer) RateMean() float64 {
+	return t.meter.RateMean()
+}
+
+// Snapshot returns a read-only copy of the timer, with the durations of the current reporting cycle.
+func (t WindowedTimer) Snapshot() metrics.Timer {
+	return t.snapshot(t.histogram.window().Snapshot())
+}
+
+// StdDev returns the standard deviation of the durations recorded during the current reporting cycle.
+func (t WindowedTimer) StdDev() float64 {
+	return t.histogram.StdDev()
+}
+
+// Stop stops the meter.
+func (t WindowedTimer) Stop() {
+	t.meter.Stop()
+}
+
+// Sum returns the sum of the durations recorded during the current reporting cycle.
+func (t WindowedTimer) Sum() int64 {
+	return t.histogram.Sum()
+}
+
+// Time record the duration of the execution of the given function.
+func (t WindowedTimer) Time(f func()) {
+	ts := time.Now()
+	f()
+	t.UpdateSince(ts)
+}
+
+// Update the duration of an event.
+func (t WindowedTimer) Update(d time.Duration) {
+	t.histogram.Update(int64(d))
+	t.meter.Mark(1)
+}
+
+// UpdateSince update the duration of an event that started at a time and ends now.
+func (t WindowedTimer) UpdateSince(ts time.Time) {
+	t.Update(time.Since(ts))
+}
+
+// Variance returns the variance of the durations recorded during the current reporting cycle.
+func (t WindowedTimer) Variance() float64 {
+	return t.histogram.Variance()
+}
+
+// windowedTimerSnapshot is a read-only copy of a WindowedTimer.
+type windowedTimerSnapshot struct {
+	histogram metrics.Histogram
+	meter     metrics.Meter
+}
+
+// Count returns the number of events recorded at the time the snapshot was taken.
+func (t windowedTimerSnapshot) Count() int64 { return t.meter.Count() }
+
+// Max returns the maximum duration of the reporting cycle at the time the snapshot was taken.
+func (t windowedTimerSnapshot) Max() int64 { return t.histogram.Max() }
+
+// Mean returns the mean duration of the reporting cycle at the time the snapshot was taken.
+func (t windowedTimerSnapshot) Mean() float64 { return t.histogram.Mean() }
+
+// Min returns the minimum duration of the reporting cycle at the time the snapshot was taken.
+func (t windowedTimerSnapshot) Min() int64 { return t.histogram.Min() }
+
+// Percentile returns an arbitrary percentile of the durations of the reporting cycle at the time the snapshot was taken.
+func (t windowedTimerSnapshot) Percentile(p float64) float64 { return t.histogram.Percentile(p) }
+
+// Percentiles returns a slice of arbitrary percentiles of the durations of the reporting cycle at the time the snapshot was taken.
+func (t windowedTimerSnapshot) Percentiles(ps []float64) []float64 {
+	return t.histogram.Percentiles(ps)
+}
+
+// Rate1 returns the one-minute moving average rate of events per second at the time the snapshot was taken.
+func (t windowedTimerSnapshot) Rate1() float64 { return t.meter.Rate1() }
+
+// Rate5 returns the five-minute moving average rate of events per second at the time the snapshot was taken.
+func (t windowedTimerSnapshot) Rate5() float64 { return t.meter.Rate5() }
+
+// Rate15 returns the fifteen-minute moving average rate of events per second at the time the snapshot was taken.
+func (t windowedTimerSnapshot) Rate15() float64 { return t.meter.Rate15() }
+
+// RateMean returns the meter's mean rate of events per second at the time the snapshot was taken.
+func (t windowedTimerSnapshot) RateMean() float64 { return t.meter.RateMean() }
+
+// Snapshot returns the snapshot.
+func (t windowedTimerSnapshot) Snapshot() metrics.Timer { return t }
+
+// StdDev returns the standard deviation of the durations of the reporting cycle at the time the snapshot was taken.
+func (t windowedTimerSnapshot) StdDev() float64 { return t.histogram.StdDev() }
+
+// Stop is a no-op.
+func (t windowedTimerSnapshot) Stop() {}
+
+// Sum returns the sum of the durations of the reporting cycle at the time the snapshot was taken.
+func (t windowedTimerSnapshot) Sum() int64 { return t.histogram.Sum() }
+
+// Time panics.
+func (windowedTimerSnapshot) Time(func()) {
+	panic("Time called on a WindowedTimer snapshot")
+}
+
+// Update panics.
+func (windowedTimerSnapshot) Update(time.Duration) {
+	panic("Update called on a WindowedTimer snapshot")
+}
+
+// UpdateSince panics.
+func (windowedTimerSnapshot) UpdateSince(time.Time) {
+	panic("UpdateSince called on a WindowedTimer snapshot")
+}
+
+// Variance returns the variance of the durations of the reporting cycle at the time the snapshot was taken.
+func (t windowedTimerSnapshot) Variance() float64 { return t.histogram.Variance() }
@@ -0,0 +1,110 @@
+package reporting
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindowedHistogram(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(), CustomRegistry(metrics.NewRegistry()))
+
+	h := NewWindowedHistogram(nil)
+	reporter.RegisterMetric("h", h, nil)
+	assert.Equal(t, TypeWindowedHistogram, TypeOf(h))
+
+	values := func() map[string]float64 {
+		res := map[string]float64{}
+		for _, m := range sender.Metrics {
+			res[m.Name] = m.Value
+		}
+		sender.Metrics = sender.Metrics[:0]
+		return res
+	}
+
+	h.Update(100)
+	h.Update(200)
+	assert.Equal(t, int64(200), h.Max())
+	reporter.Report()
+	first := values()
+	assert.Equal(t, 2.0, first["h.count"])
+	assert.Equal(t, 100.0, first["h.min"])
+	assert.Equal(t, 200.0, first["h.max"])
+
+	h.Update(5)
+	reporter.Report()
+	second := values()
+	assert.Equal(t, 3.0, second["h.count"])
+	assert.Equal(t, 5.0, second["h.min"])
+	assert.Equal(t, 5.0, second["h.max"])
+	assert.Equal(t, int64(0), h.Max())
+	assert.Equal(t, int64(3), h.Count())
+
+	reporter.Close()
+}
+
+func TestWindowedTimer(t *testing.T) {
+	sender := newMockSender()
+	reporter := NewMetricsReporter(sender, DisableAutoStart(), CustomRegistry(metrics.NewRegistry()))
+
+	timer := NewWindowedTimer(func() metrics.Histogram { return metrics.NewHistogram(metrics.NewUniformSample(100)) })
+	reporter.RegisterMetric("t", timer, nil)
+	assert.Equal(t, TypeWindowedTimer, TypeOf(timer))
+
+	timer.Update(time.Second)
+	snapshot := timer.Snapshot()
+	reporter.Report()
+	timer.Update(time.Millisecond)
+	reporter.Report()
+
+	assert.Equal(t, int64(1), snapshot.Count())
+	assert.Equal(t, int64(time.Second), snapshot.Max())
+	assert.Equal(t, int64(2), timer.Count())
+	assert.Equal(t, int64(0), timer.Max())
+
+	var maxes []float64
+	for _, m := range sender.Metrics {
+		if m.Name == "t.max" {
+			maxes = append(maxes, m.Value)
+		}
+	}
+	assert.Equal(t, []float64{float64(time.Second), float64(time.Millisecond)}, maxes)
+
+	reporter.Close()
+}
+
+func TestWindowedHistogramConcurrentSwap(t *testing.T) {
+	h := NewWindowedHistogram(func() metrics.Histogram { return metrics.NewHistogram(metrics.NewUniformSample(100000)) }).(WindowedHistogram)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10000; j++ {
+				h.Update(1)
+			}
+		}()
+	}
+
+	var recorded int64
+	done := make(chan bool)
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		recorded += h.swap().Sample().Count()
+	}
+	assert.Equal(t, int64(40000), recorded)
+	assert.Equal(t, int64(40000), h.Count())
+}